@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bidder/models"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+const apiKeysUsage = `Usage:
+  bidder apikeys create <name> <admin|operator|cashier|reader>
+  bidder apikeys list
+  bidder apikeys revoke <id>`
+
+// apiKeysCommand manages the API keys of the clients from the command line
+func apiKeysCommand(args []string) {
+	if len(args) == 0 {
+		exitWithUsage()
+	}
+
+	switch {
+	case args[0] == "create" && len(args) == 3:
+		apiKey := models.APIKey{Name: args[1], Role: args[2]}
+		if err := apiKey.Validate(); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := apiKey.Create(); err != nil {
+			log.Fatalf("Cannot create API key due to error: %s", err)
+		}
+
+		fmt.Printf("Created API key %d for %s with %s role.\n", apiKey.ID, apiKey.Name, apiKey.Role)
+		fmt.Printf("Key: %s\n", apiKey.Key)
+		fmt.Println("Save it now, it cannot be shown again.")
+
+	case args[0] == "list" && len(args) == 1:
+		apiKeys, err := models.ListAPIKeys()
+		if err != nil {
+			log.Fatalf("Cannot list API keys due to error: %s", err)
+		}
+
+		for _, apiKey := range apiKeys {
+			status := "active"
+			if apiKey.RevokedAt != nil {
+				status = "revoked at " + apiKey.RevokedAt.Format("2006-01-02 15:04:05")
+			}
+
+			fmt.Printf("%d\t%s\t%s\t%s\n", apiKey.ID, apiKey.Name, apiKey.Role, status)
+		}
+
+	case args[0] == "revoke" && len(args) == 2:
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			exitWithUsage()
+		}
+
+		if err := models.RevokeAPIKey(id); err != nil {
+			log.Fatalf("Cannot revoke API key due to error: %s", err)
+		}
+
+		fmt.Printf("API key %d is revoked.\n", id)
+
+	default:
+		exitWithUsage()
+	}
+}
+
+func exitWithUsage() {
+	fmt.Fprintln(os.Stderr, apiKeysUsage)
+	os.Exit(2)
+}
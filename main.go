@@ -2,15 +2,27 @@ package main
 
 import (
 	"log"
+	"os"
 
+	"bidder/models"
 	"bidder/router"
 	"bidder/util"
 )
 
 func main() {
 	defer func() { util.DBConnect.Close() }()
+
+	if len(os.Args) > 1 && os.Args[1] == "apikeys" {
+		apiKeysCommand(os.Args[2:])
+		return
+	}
+
 	log.Println("Welcome to the Bidder app!")
 
+	if interval := util.SchedulerInterval(); interval > 0 {
+		go models.RunScheduler(interval)
+	}
+
 	r := router.New()
 	r.Run()
 }
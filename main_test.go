@@ -1,11 +1,22 @@
 package main
 
 import (
+	"bidder/models"
 	"bidder/router"
+	"bidder/util"
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -16,8 +27,19 @@ import (
 // host for test server
 const HOST = "http://localhost:3001"
 
+// admin token used by the tests to reset the DataBase
+const ADMIN_TOKEN = "test-admin-token"
+
+// API key of admin role used by the tests, created on start
+var apiKey string
+
 // and initialize the server for testing
 func init() {
+	os.Setenv("ALLOW_RESET", "true")
+	os.Setenv("ADMIN_TOKEN", ADMIN_TOKEN)
+
+	apiKey = createAPIKey(models.RoleAdmin)
+
 	r := router.New()
 
 	go r.Run(":3001")
@@ -27,8 +49,33 @@ func init() {
 // the set of helper structs and functions to avoid code duplication
 // and reduce overall code amount and complexity
 type playerBalance struct {
-	PlayerID string
-	Balance  int
+	PlayerID    string
+	Balance     int
+	Balances    map[string]int
+	Available   map[string]int
+	Held        map[string]int
+	Bonus       map[string]int
+	Restricted  map[string]int
+	Wagering    map[string]int
+	DisplayName string
+	Region      string
+	Status      string
+}
+
+type balanceHold struct {
+	ID     int
+	Amount int
+	Status string
+}
+
+type batchResults struct {
+	Succeeded int
+	Failed    int
+	Results   []struct {
+		Index  int
+		Status string
+		Error  *apiError
+	}
 }
 
 type winner struct {
@@ -41,8 +88,35 @@ type tournament struct {
 	Winners      []winner `json:"winners,omitempty"`
 }
 
-func getRequest(t *testing.T, uri string) (*http.Response, string) {
-	response, err := http.Get(HOST + uri)
+func createAPIKey(role string) string {
+	key := models.APIKey{Name: "tests", Role: role}
+	if err := key.Create(); err != nil {
+		log.Fatal(err)
+	}
+
+	return key.Key
+}
+
+func request(t *testing.T, method, uri, key string, data interface{}) (*http.Response, string) {
+	var body io.Reader
+	if data != nil {
+		postJSON, err := json.Marshal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = bytes.NewBuffer(postJSON)
+	}
+
+	request, err := http.NewRequest(method, HOST+uri, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if len(key) != 0 {
+		request.Header.Set("X-API-Key", key)
+	}
+
+	response, err := http.DefaultClient.Do(request)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -50,13 +124,30 @@ func getRequest(t *testing.T, uri string) (*http.Response, string) {
 	return response, getResponceBody(t, response)
 }
 
-func postRequest(t *testing.T, uri string, data interface{}) (*http.Response, string) {
+// signedRequest sends the result signed by the partner with the given timestamp, the query is not signed
+func signedRequest(t *testing.T, uri, secret string, timestamp time.Time, data interface{}) (*http.Response, string) {
 	postJSON, err := json.Marshal(data)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	response, err := http.Post(HOST+uri, "application/json", bytes.NewBuffer(postJSON))
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	path := strings.SplitN(uri, "?", 2)[0]
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix + "\n" + path + "\n"))
+	mac.Write(postJSON)
+
+	request, err := http.NewRequest(http.MethodPost, HOST+uri, bytes.NewBuffer(postJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-API-Key", apiKey)
+	request.Header.Set("X-Partner-Id", "partner")
+	request.Header.Set("X-Timestamp", unix)
+	request.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+
+	response, err := http.DefaultClient.Do(request)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -64,6 +155,18 @@ func postRequest(t *testing.T, uri string, data interface{}) (*http.Response, st
 	return response, getResponceBody(t, response)
 }
 
+func getRequest(t *testing.T, uri string) (*http.Response, string) {
+	return request(t, http.MethodGet, uri, apiKey, nil)
+}
+
+func postRequest(t *testing.T, uri string, data interface{}) (*http.Response, string) {
+	return request(t, http.MethodPost, uri, apiKey, data)
+}
+
+func deleteRequest(t *testing.T, uri string) (*http.Response, string) {
+	return request(t, http.MethodDelete, uri, apiKey, nil)
+}
+
 func getResponceBody(t *testing.T, response *http.Response) string {
 	body, err := ioutil.ReadAll(response.Body)
 	response.Body.Close()
@@ -82,8 +185,164 @@ func parseJSONPlayerBody(t *testing.T, body string) playerBalance {
 	return data
 }
 
+type transaction struct {
+	PlayerID     string
+	TournamentID int
+	AttendeeID   string
+	TransferID   int
+	Type         string
+	Amount       int
+}
+
+type transactionsPage struct {
+	Transactions []transaction
+	NextCursor   int
+}
+
+func parseJSONTransactionsBody(t *testing.T, body string) transactionsPage {
+	var data transactionsPage
+
+	if err := json.Unmarshal([]byte(body), &data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+type tournamentInfo struct {
+	TournamentID   int
+	Deposit        int
+	Name           string
+	GameType       string
+	StartsAt       *time.Time
+	MaxAttendees   int
+	MinAttendees   int
+	Status         string
+	AttendeesCount int
+	Pool           int
+	Results        []winner
+}
+
+type tournamentsPage struct {
+	Tournaments []tournamentInfo
+	NextCursor  int
+}
+
+type tournamentAttendee struct {
+	PlayerID     string
+	Backers      []string
+	Stake        int
+	BackerStakes []int
+}
+
+func parseJSONTournamentBody(t *testing.T, body string) tournamentInfo {
+	var data tournamentInfo
+
+	if err := json.Unmarshal([]byte(body), &data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func parseJSONTournamentsBody(t *testing.T, body string) tournamentsPage {
+	var data tournamentsPage
+
+	if err := json.Unmarshal([]byte(body), &data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func parseJSONAttendeesBody(t *testing.T, body string) []tournamentAttendee {
+	var data struct {
+		Attendees []tournamentAttendee
+	}
+
+	if err := json.Unmarshal([]byte(body), &data); err != nil {
+		t.Fatal(err)
+	}
+	return data.Attendees
+}
+
+type payout struct {
+	PlayerID   string
+	Amount     int
+	Restricted int
+}
+
+type prizeResult struct {
+	PlayerID string
+	Position int
+	Prize    int
+	Payouts  []payout
+}
+
+func parseJSONResultsBody(t *testing.T, body string) []prizeResult {
+	var data struct {
+		Results []prizeResult
+	}
+
+	if err := json.Unmarshal([]byte(body), &data); err != nil {
+		t.Fatal(err)
+	}
+	return data.Results
+}
+
+// ledgerSum function sums up every ledger entry of the player, newest first
+func ledgerSum(t *testing.T, playerID string) int {
+	_, body := getRequest(t, "/players/"+playerID+"/transactions?limit=500")
+
+	sum := 0
+	for _, entry := range parseJSONTransactionsBody(t, body).Transactions {
+		sum += entry.Amount
+	}
+	return sum
+}
+
+type apiError struct {
+	Code    string
+	Message string
+}
+
+func parseJSONHoldBody(t *testing.T, body string) balanceHold {
+	var hold balanceHold
+
+	if err := json.Unmarshal([]byte(body), &hold); err != nil {
+		t.Fatal(err)
+	}
+	return hold
+}
+
+func parseJSONErrorBody(t *testing.T, body string) apiError {
+	var data struct {
+		Error apiError
+	}
+
+	if err := json.Unmarshal([]byte(body), &data); err != nil {
+		t.Fatal(err)
+	}
+	return data.Error
+}
+
+func resetRequest(t *testing.T, token string) *http.Response {
+	request, err := http.NewRequest(http.MethodGet, HOST+"/reset", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("X-Admin-Token", token)
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	return response
+}
+
 func resetDB(t *testing.T) {
-	getRequest(t, "/reset")
+	if res := resetRequest(t, ADMIN_TOKEN); res.StatusCode != http.StatusOK {
+		t.Fatalf("Cannot reset DataBase, got %d status code", res.StatusCode)
+	}
 }
 
 // Actual tests start here:
@@ -97,6 +356,168 @@ func TestGeneralEndpoints(t *testing.T) {
 	})
 }
 
+func TestErrorCodes(t *testing.T) {
+	Convey("Test error codes", t, func() {
+		resetDB(t)
+
+		Convey("When I take points from unexisting player", func() {
+			res, body := getRequest(t, "/take?playerId=P1&points=300")
+
+			Convey("Then I get 404 status code with PLAYER_NOT_FOUND code", func() {
+				So(res.StatusCode, ShouldEqual, 404)
+				So(parseJSONErrorBody(t, body).Code, ShouldEqual, "PLAYER_NOT_FOUND")
+			})
+		})
+
+		Convey("Given I fund P1 with 300 points", func() {
+			getRequest(t, "/fund?playerId=P1&points=300")
+
+			Convey("When I take too many points from P1", func() {
+				res, body := getRequest(t, "/take?playerId=P1&points=500")
+
+				Convey("Then I get 400 status code with INSUFFICIENT_FUNDS code", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+					So(parseJSONErrorBody(t, body).Code, ShouldEqual, "INSUFFICIENT_FUNDS")
+				})
+			})
+
+			Convey("When I fund P1 with negative points", func() {
+				res, body := getRequest(t, "/fund?playerId=P1&points=-300")
+
+				Convey("Then I get 400 status code with VALIDATION_FAILED code", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+					So(parseJSONErrorBody(t, body).Code, ShouldEqual, "VALIDATION_FAILED")
+				})
+			})
+
+			Convey("When I join P1 to the tournament twice", func() {
+				getRequest(t, "/announceTournament?tournamentId=1&deposit=100")
+				getRequest(t, "/joinTournament?tournamentId=1&playerId=P1")
+				res, body := getRequest(t, "/joinTournament?tournamentId=1&playerId=P1")
+
+				Convey("Then I get 400 status code with ALREADY_JOINED code", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+					So(parseJSONErrorBody(t, body).Code, ShouldEqual, "ALREADY_JOINED")
+				})
+			})
+
+			Convey("When I announce the same tournament twice", func() {
+				getRequest(t, "/announceTournament?tournamentId=1&deposit=100")
+				res, body := getRequest(t, "/announceTournament?tournamentId=1&deposit=100")
+
+				Convey("Then I get 400 status code with TOURNAMENT_EXISTS code", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+					So(parseJSONErrorBody(t, body).Code, ShouldEqual, "TOURNAMENT_EXISTS")
+				})
+			})
+		})
+	})
+}
+
+func TestReset(t *testing.T) {
+	Convey("Test reset protection", t, func() {
+		resetDB(t)
+		getRequest(t, "/fund?playerId=P1&points=300")
+
+		Convey("When I reset the DataBase without admin token", func() {
+			res, _ := getRequest(t, "/reset")
+
+			Convey("Then I get 401 status code", func() {
+				So(res.StatusCode, ShouldEqual, 401)
+			})
+
+			Convey("And the player is still there", func() {
+				res, _ := getRequest(t, "/balance?playerId=P1")
+				So(res.StatusCode, ShouldEqual, 200)
+			})
+		})
+
+		Convey("When I reset the DataBase with wrong admin token", func() {
+			res := resetRequest(t, "wrong")
+
+			Convey("Then I get 401 status code", func() {
+				So(res.StatusCode, ShouldEqual, 401)
+			})
+		})
+
+		Convey("When the reset is disabled", func() {
+			os.Setenv("ALLOW_RESET", "false")
+			res := resetRequest(t, ADMIN_TOKEN)
+			os.Setenv("ALLOW_RESET", "true")
+
+			Convey("Then I get 403 status code", func() {
+				So(res.StatusCode, ShouldEqual, 403)
+			})
+		})
+	})
+}
+
+func TestAuthorization(t *testing.T) {
+	Convey("Test API key authorization", t, func() {
+		resetDB(t)
+		getRequest(t, "/fund?playerId=P1&points=300")
+
+		Convey("When I call balance without API key", func() {
+			res, body := request(t, http.MethodGet, "/balance?playerId=P1", "", nil)
+
+			Convey("Then I get 401 status code", func() {
+				So(res.StatusCode, ShouldEqual, 401)
+				So(parseJSONErrorBody(t, body).Code, ShouldEqual, "UNAUTHORIZED")
+			})
+		})
+
+		Convey("When I call balance with unknown API key", func() {
+			res, _ := request(t, http.MethodGet, "/balance?playerId=P1", "unknown", nil)
+
+			Convey("Then I get 401 status code", func() {
+				So(res.StatusCode, ShouldEqual, 401)
+			})
+		})
+
+		Convey("Given I have API key of reader role", func() {
+			readerKey := createAPIKey(models.RoleReader)
+
+			Convey("When I call balance with it", func() {
+				res, _ := request(t, http.MethodGet, "/balance?playerId=P1", readerKey, nil)
+
+				Convey("Then I get 200 status code", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+				})
+			})
+
+			Convey("When I fund the player with it", func() {
+				res, body := request(t, http.MethodGet, "/fund?playerId=P1&points=300", readerKey, nil)
+
+				Convey("Then I get 403 status code", func() {
+					So(res.StatusCode, ShouldEqual, 403)
+					So(parseJSONErrorBody(t, body).Code, ShouldEqual, "FORBIDDEN")
+				})
+			})
+		})
+
+		Convey("Given I have API key of cashier role", func() {
+			cashierKey := createAPIKey(models.RoleCashier)
+
+			Convey("When I fund the player with it", func() {
+				res, _ := request(t, http.MethodPost, "/v2/players/P1/fund", cashierKey, map[string]int{"points": 100})
+
+				Convey("Then I get 200 status code", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+				})
+			})
+
+			Convey("When I announce the tournament with it", func() {
+				tournament := map[string]int{"tournamentId": 1, "deposit": 100}
+				res, _ := request(t, http.MethodPost, "/v2/tournaments", cashierKey, tournament)
+
+				Convey("Then I get 403 status code", func() {
+					So(res.StatusCode, ShouldEqual, 403)
+				})
+			})
+		})
+	})
+}
+
 func TestPlayerBalance(t *testing.T) {
 	Convey("Test user balance", t, func() {
 		resetDB(t)
@@ -407,8 +828,8 @@ func TestTournamentResult(t *testing.T) {
 		Convey("Given I set player P1 with 1000 points", func() {
 			getRequest(t, "/fund?playerId=P1&points=1000")
 
-			Convey("And I announce a tournament with deposit 500", func() {
-				getRequest(t, "/announceTournament?tournamentId=1&deposit=500")
+			Convey("And I announce a tournament with deposit 500 and guaranteed pool 1000", func() {
+				getRequest(t, "/announceTournament?tournamentId=1&deposit=500&guaranteedPool=1000")
 
 				Convey("Then I join the tournament with player P1", func() {
 					res, _ := getRequest(t, "/joinTournament?tournamentId=1&playerId=P1")
@@ -420,6 +841,7 @@ func TestTournamentResult(t *testing.T) {
 					Convey("And When I result tournament with P1 as a winner with 1000 win", func() {
 						winner1 := winner{PlayerID: "P1", Prize: 1000}
 						result := tournament{TournamentID: "1", Winners: []winner{winner1}}
+						postRequest(t, "/tournaments/1/start", nil)
 
 						res, _ := postRequest(t, "/resultTournament", result)
 
@@ -459,6 +881,7 @@ func TestTournamentResult(t *testing.T) {
 						Convey("And when I result tournament with P1 as a winner with 1000 win", func() {
 							winner1 := winner{PlayerID: "P1", Prize: 1000}
 							result := tournament{TournamentID: "1", Winners: []winner{winner1}}
+							postRequest(t, "/tournaments/1/start", nil)
 
 							res, _ := postRequest(t, "/resultTournament", result)
 
@@ -491,43 +914,61 @@ func TestTournamentResult(t *testing.T) {
 	})
 }
 
-func TestConcurrentFund(t *testing.T) {
-	Convey("Test fund endpoint concurrently", t, func() {
+func TestTournamentResultValidation(t *testing.T) {
+	Convey("Test result tournament validation", t, func() {
 		resetDB(t)
 
-		Convey("Given I call fund endpoint 10 times in different goroutines", func() {
-			const requestsCount = 10
-			responses := make(chan int, requestsCount)
+		Convey("Given I set players P1, P2 and P3 with 1000 points", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/fund?playerId=P2&points=1000")
+			getRequest(t, "/fund?playerId=P3&points=1000")
 
-			var wg sync.WaitGroup
-			for i := 1; i <= requestsCount; i++ {
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					res, _ := getRequest(t, "/fund?playerId=P1&points=100")
-					responses <- res.StatusCode
-				}()
-			}
-			wg.Wait()
+			Convey("And I run a tournament with deposit 500 attended by P1 and P2", func() {
+				getRequest(t, "/announceTournament?tournamentId=1&deposit=500")
+				getRequest(t, "/joinTournament?tournamentId=1&playerId=P1")
+				getRequest(t, "/joinTournament?tournamentId=1&playerId=P2")
+				postRequest(t, "/tournaments/1/start", nil)
 
-			Convey("When I count every successful response", func() {
-				successResponses := 0
-				for i := 1; i <= requestsCount; i++ {
-					if 200 == <-responses {
-						successResponses++
-					}
-				}
+				Convey("When I result it with the same winner twice", func() {
+					result := tournament{TournamentID: "1", Winners: []winner{{PlayerID: "P1", Prize: 100}, {PlayerID: "P1", Prize: 100}}}
+					res, body := postRequest(t, "/resultTournament", result)
 
-				Convey("Then I get 10 responses with 200 status code", func() {
-					So(successResponses, ShouldEqual, requestsCount)
+					Convey("Then I get 422 status code with the invalid field", func() {
+						So(res.StatusCode, ShouldEqual, 422)
+						So(body, ShouldContainSubstring, "winners[1].playerId")
+					})
 				})
 
-				Convey("And when I check the player's balance", func() {
-					_, body := getRequest(t, "/balance?playerId=P1")
-					balanceData := parseJSONPlayerBody(t, body)
+				Convey("When I result it with the winner who is not an attendee", func() {
+					result := tournament{TournamentID: "1", Winners: []winner{{PlayerID: "P3", Prize: 100}}}
+					res, body := postRequest(t, "/resultTournament", result)
 
-					Convey("Then his balance should equal 1000", func() {
-						So(balanceData.Balance, ShouldEqual, 1000)
+					Convey("Then I get 422 status code with the invalid field", func() {
+						So(res.StatusCode, ShouldEqual, 422)
+						So(body, ShouldContainSubstring, "winners[0].playerId")
+					})
+
+					Convey("And P3 gets nothing", func() {
+						_, body := getRequest(t, "/balance?playerId=P3")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+					})
+				})
+
+				Convey("When I result it with prizes bigger than the collected deposits", func() {
+					result := tournament{TournamentID: "1", Winners: []winner{{PlayerID: "P1", Prize: 800}, {PlayerID: "P2", Prize: 201}}}
+					res, _ := postRequest(t, "/resultTournament", result)
+
+					Convey("Then I get 422 status code", func() {
+						So(res.StatusCode, ShouldEqual, 422)
+					})
+				})
+
+				Convey("When I result it with prizes equal to the collected deposits", func() {
+					result := tournament{TournamentID: "1", Winners: []winner{{PlayerID: "P1", Prize: 800}, {PlayerID: "P2", Prize: 200}}}
+					res, _ := postRequest(t, "/resultTournament", result)
+
+					Convey("Then I get 200 status code", func() {
+						So(res.StatusCode, ShouldEqual, 200)
 					})
 				})
 			})
@@ -535,12 +976,2065 @@ func TestConcurrentFund(t *testing.T) {
 	})
 }
 
-func TestConcurrentTake(t *testing.T) {
-	Convey("Test take endpoint concurrently", t, func() {
+func TestSignedTournamentResult(t *testing.T) {
+	os.Setenv("RESULT_SIGNING_SECRETS", "partner:partner-secret")
+	defer os.Unsetenv("RESULT_SIGNING_SECRETS")
+
+	Convey("Test signed result tournament", t, func() {
 		resetDB(t)
 
-		Convey("Given I set player P1 with 100 points", func() {
-			getRequest(t, "/fund?playerId=P1&points=100")
+		Convey("Given I run a tournament with deposit 500 attended by P1 with 1000 points", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/announceTournament?tournamentId=1&deposit=500")
+			getRequest(t, "/joinTournament?tournamentId=1&playerId=P1")
+			postRequest(t, "/tournaments/1/start", nil)
+
+			result := tournament{TournamentID: "1", Winners: []winner{{PlayerID: "P1", Prize: 500}}}
+
+			Convey("When I result it without the signature", func() {
+				res, body := postRequest(t, "/resultTournament", result)
+
+				Convey("Then I get 401 status code and P1 gets nothing", func() {
+					So(res.StatusCode, ShouldEqual, 401)
+					So(parseJSONErrorBody(t, body).Code, ShouldEqual, "INVALID_SIGNATURE")
+
+					_, body := getRequest(t, "/balance?playerId=P1")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 500)
+				})
+			})
+
+			Convey("When I result it signed with the wrong secret", func() {
+				res, _ := signedRequest(t, "/resultTournament", "forged-secret", time.Now(), result)
+
+				Convey("Then I get 401 status code", func() {
+					So(res.StatusCode, ShouldEqual, 401)
+				})
+			})
+
+			Convey("When I result it with the stale signature", func() {
+				res, _ := signedRequest(t, "/resultTournament", "partner-secret", time.Now().Add(-time.Hour), result)
+
+				Convey("Then I get 401 status code", func() {
+					So(res.StatusCode, ShouldEqual, 401)
+				})
+			})
+
+			Convey("When I result it with the valid signature", func() {
+				timestamp := time.Now()
+				res, _ := signedRequest(t, "/resultTournament", "partner-secret", timestamp, result)
+
+				Convey("Then I get 200 status code and P1 gets the prize", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+
+					_, body := getRequest(t, "/balance?playerId=P1")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+				})
+
+				Convey("And the same signed request is replayed", func() {
+					res, body := signedRequest(t, "/resultTournament", "partner-secret", timestamp, result)
+
+					Convey("Then I get 401 status code", func() {
+						So(res.StatusCode, ShouldEqual, 401)
+						So(parseJSONErrorBody(t, body).Code, ShouldEqual, "INVALID_SIGNATURE")
+					})
+				})
+			})
+
+			Convey("When I result it with the valid signature and retry it with the same request ID", func() {
+				timestamp := time.Now()
+				signedRequest(t, "/resultTournament?requestId=R1", "partner-secret", timestamp, result)
+				res, _ := signedRequest(t, "/resultTournament?requestId=R1", "partner-secret", timestamp, result)
+
+				Convey("Then I get the replayed 200 status code and P1 gets the prize once", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+					So(res.Header.Get("Idempotent-Replayed"), ShouldEqual, "true")
+
+					_, body := getRequest(t, "/balance?playerId=P1")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+				})
+			})
+
+			Convey("When I result the tournament which is not started with the valid signature", func() {
+				getRequest(t, "/announceTournament?tournamentId=2&deposit=100")
+				getRequest(t, "/joinTournament?tournamentId=2&playerId=P1")
+				notStarted := tournament{TournamentID: "2", Winners: []winner{{PlayerID: "P1", Prize: 100}}}
+				timestamp := time.Now()
+				res, _ := signedRequest(t, "/resultTournament", "partner-secret", timestamp, notStarted)
+
+				Convey("Then I get 400 status code", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+				})
+
+				Convey("And when I start it and retry the same signed request", func() {
+					postRequest(t, "/tournaments/2/start", nil)
+					res, _ := signedRequest(t, "/resultTournament", "partner-secret", timestamp, notStarted)
+
+					Convey("Then I get 200 status code, as the rejected request did not use up the signature", func() {
+						So(res.StatusCode, ShouldEqual, 200)
+					})
+				})
+			})
+		})
+	})
+}
+
+func TestTournamentLifecycle(t *testing.T) {
+	Convey("Test tournament lifecycle", t, func() {
+		resetDB(t)
+
+		Convey("Given I set player P1 with 1000 points and announce a tournament with deposit 500", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/announceTournament?tournamentId=1&deposit=500")
+			result := tournament{TournamentID: "1", Winners: []winner{{PlayerID: "P1", Prize: 500}}}
+
+			Convey("When I change the status of unexisting tournament", func() {
+				res, _ := postRequest(t, "/tournaments/2/start", nil)
+
+				Convey("Then I get 404 status code", func() {
+					So(res.StatusCode, ShouldEqual, 404)
+				})
+			})
+
+			Convey("When I close the registration", func() {
+				res, _ := postRequest(t, "/tournaments/1/close", nil)
+
+				Convey("Then I get 200 status code", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+				})
+
+				Convey("And when I try to join it with P1 player", func() {
+					res, _ := getRequest(t, "/joinTournament?tournamentId=1&playerId=P1")
+
+					Convey("Then I get 400 status code", func() {
+						So(res.StatusCode, ShouldEqual, 400)
+					})
+				})
+
+				Convey("And when I open the registration again and join it with P1 player", func() {
+					postRequest(t, "/tournaments/1/open", nil)
+					res, _ := getRequest(t, "/joinTournament?tournamentId=1&playerId=P1")
+
+					Convey("Then I get 200 status code", func() {
+						So(res.StatusCode, ShouldEqual, 200)
+					})
+				})
+			})
+
+			Convey("When I join it with P1 player and result it before the start", func() {
+				getRequest(t, "/joinTournament?tournamentId=1&playerId=P1")
+				res, _ := postRequest(t, "/resultTournament", result)
+
+				Convey("Then I get 400 status code", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+				})
+
+				Convey("And when I start it and result it", func() {
+					res, _ := postRequest(t, "/tournaments/1/start", nil)
+					So(res.StatusCode, ShouldEqual, 200)
+
+					res, _ = postRequest(t, "/resultTournament", result)
+
+					Convey("Then I get 200 status code", func() {
+						So(res.StatusCode, ShouldEqual, 200)
+					})
+
+					Convey("And when I try to start it again", func() {
+						res, _ := postRequest(t, "/tournaments/1/start", nil)
+
+						Convey("Then I get 400 status code", func() {
+							So(res.StatusCode, ShouldEqual, 400)
+						})
+					})
+				})
+			})
+		})
+	})
+}
+
+func TestTournamentCancel(t *testing.T) {
+	Convey("Test cancel tournament", t, func() {
+		resetDB(t)
+
+		Convey("Given I set players P1, P2 and P3 with 1000 points", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/fund?playerId=P2&points=1000")
+			getRequest(t, "/fund?playerId=P3&points=1000")
+
+			Convey("And I announce a tournament with deposit 1000 and join P1 with backers P2 and P3", func() {
+				getRequest(t, "/announceTournament?tournamentId=1&deposit=1000")
+				getRequest(t, "/joinTournament?tournamentId=1&playerId=P1&backerId=P2&backerId=P3")
+
+				Convey("When I cancel the tournament", func() {
+					res, _ := postRequest(t, "/tournaments/1/cancel", nil)
+
+					Convey("Then I get 200 status code", func() {
+						So(res.StatusCode, ShouldEqual, 200)
+					})
+
+					Convey("And every player gets his deposit back", func() {
+						for _, playerID := range []string{"P1", "P2", "P3"} {
+							_, body := getRequest(t, "/balance?playerId="+playerID)
+							So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+						}
+					})
+
+					Convey("And when I cancel the tournament second time", func() {
+						res, _ := postRequest(t, "/tournaments/1/cancel", nil)
+
+						Convey("Then I get 400 status code", func() {
+							So(res.StatusCode, ShouldEqual, 400)
+						})
+
+						Convey("And nobody gets the deposit twice", func() {
+							_, body := getRequest(t, "/balance?playerId=P1")
+							So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+						})
+					})
+
+					Convey("And when I try to start it", func() {
+						res, _ := postRequest(t, "/tournaments/1/start", nil)
+
+						Convey("Then I get 400 status code", func() {
+							So(res.StatusCode, ShouldEqual, 400)
+						})
+					})
+				})
+
+				Convey("When I cancel the running tournament", func() {
+					postRequest(t, "/tournaments/1/start", nil)
+					res, _ := postRequest(t, "/tournaments/1/cancel", nil)
+
+					Convey("Then I get 200 status code", func() {
+						So(res.StatusCode, ShouldEqual, 200)
+					})
+
+					Convey("And when I try to result it", func() {
+						result := tournament{TournamentID: "1", Winners: []winner{{PlayerID: "P1", Prize: 1000}}}
+						res, _ := postRequest(t, "/resultTournament", result)
+
+						Convey("Then I get 400 status code", func() {
+							So(res.StatusCode, ShouldEqual, 400)
+						})
+					})
+				})
+			})
+		})
+
+		Convey("When I cancel unexisting tournament", func() {
+			res, _ := postRequest(t, "/tournaments/1/cancel", nil)
+
+			Convey("Then I get 404 status code", func() {
+				So(res.StatusCode, ShouldEqual, 404)
+			})
+		})
+	})
+}
+
+func TestTournamentLeave(t *testing.T) {
+	Convey("Test leave tournament", t, func() {
+		resetDB(t)
+
+		Convey("Given I set players P1 and P2 with 1000 points", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/fund?playerId=P2&points=1000")
+
+			Convey("And I announce a tournament with deposit 500 and join P1 with backer P2", func() {
+				getRequest(t, "/announceTournament?tournamentId=1&deposit=500")
+				getRequest(t, "/joinTournament?tournamentId=1&playerId=P1&backerId=P2:400")
+
+				Convey("When P1 leaves the tournament", func() {
+					res, _ := postRequest(t, "/tournaments/1/leave?playerId=P1", nil)
+
+					Convey("Then I get 200 status code", func() {
+						So(res.StatusCode, ShouldEqual, 200)
+					})
+
+					Convey("And P1 and P2 get their deposits back", func() {
+						_, body := getRequest(t, "/balance?playerId=P1")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+
+						_, body = getRequest(t, "/balance?playerId=P2")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+					})
+
+					Convey("And when P1 leaves the tournament second time", func() {
+						res, _ := postRequest(t, "/tournaments/1/leave?playerId=P1", nil)
+
+						Convey("Then I get 404 status code", func() {
+							So(res.StatusCode, ShouldEqual, 404)
+						})
+					})
+
+					Convey("And when P1 joins the tournament again and it gets cancelled", func() {
+						res, _ := getRequest(t, "/joinTournament?tournamentId=1&playerId=P1")
+						So(res.StatusCode, ShouldEqual, 200)
+
+						postRequest(t, "/tournaments/1/cancel", nil)
+
+						Convey("Then every player has his points back exactly once", func() {
+							_, body := getRequest(t, "/balance?playerId=P1")
+							So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+
+							_, body = getRequest(t, "/balance?playerId=P2")
+							So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+						})
+					})
+				})
+
+				Convey("When P1 leaves the started tournament", func() {
+					postRequest(t, "/tournaments/1/start", nil)
+					res, _ := postRequest(t, "/tournaments/1/leave?playerId=P1", nil)
+
+					Convey("Then I get 400 status code", func() {
+						So(res.StatusCode, ShouldEqual, 400)
+					})
+				})
+			})
+		})
+	})
+}
+
+func TestTournamentRemainder(t *testing.T) {
+	Convey("Test tournament remainder", t, func() {
+		resetDB(t)
+
+		Convey("Given I set players P1, P2 and P3 with 1000 points", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/fund?playerId=P2&points=1000")
+			getRequest(t, "/fund?playerId=P3&points=1000")
+
+			Convey("And I announce a tournament with deposit 1000", func() {
+				getRequest(t, "/announceTournament?tournamentId=1&deposit=1000")
+
+				Convey("When I join the tournament with player P1 and backers P2 and P3", func() {
+					res, _ := getRequest(t, "/joinTournament?tournamentId=1&playerId=P1&backerId=P2&backerId=P3")
+
+					Convey("Then I get 200 status code", func() {
+						So(res.StatusCode, ShouldEqual, 200)
+					})
+
+					Convey("And P1 pays the remainder of the deposit", func() {
+						_, body := getRequest(t, "/balance?playerId=P1")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 666)
+
+						_, body = getRequest(t, "/balance?playerId=P2")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 667)
+					})
+
+					Convey("And when I result tournament with P1 as a winner with 1000 win", func() {
+						winner1 := winner{PlayerID: "P1", Prize: 1000}
+						result := tournament{TournamentID: "1", Winners: []winner{winner1}}
+						postRequest(t, "/tournaments/1/start", nil)
+
+						res, _ := postRequest(t, "/resultTournament", result)
+
+						Convey("Then I get 200 status code", func() {
+							So(res.StatusCode, ShouldEqual, 200)
+						})
+
+						Convey("And the whole prize is paid with the remainder to P1", func() {
+							_, body := getRequest(t, "/balance?playerId=P1")
+							So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+
+							_, body = getRequest(t, "/balance?playerId=P2")
+							So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+
+							_, body = getRequest(t, "/balance?playerId=P3")
+							So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+						})
+					})
+				})
+			})
+		})
+	})
+}
+
+func TestTournamentBackerStakes(t *testing.T) {
+	Convey("Test tournament backer stakes", t, func() {
+		resetDB(t)
+
+		Convey("Given I set players P1 and P2 with 1000 points", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/fund?playerId=P2&points=1000")
+
+			Convey("And I announce a tournament with deposit 500 and guaranteed pool 1000", func() {
+				getRequest(t, "/announceTournament?tournamentId=1&deposit=500&guaranteedPool=1000")
+
+				Convey("When I join the tournament with player P1 and backer P2 with 300 points stake", func() {
+					res, _ := getRequest(t, "/joinTournament?tournamentId=1&playerId=P1&backerId=P2:300")
+
+					Convey("Then I get 200 status code", func() {
+						So(res.StatusCode, ShouldEqual, 200)
+					})
+
+					Convey("And P1 pays 200 points and P2 pays 300 points", func() {
+						_, body := getRequest(t, "/balance?playerId=P1")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 800)
+
+						_, body = getRequest(t, "/balance?playerId=P2")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 700)
+					})
+
+					Convey("And when I result tournament with P1 as a winner with 1000 win", func() {
+						winner1 := winner{PlayerID: "P1", Prize: 1000}
+						result := tournament{TournamentID: "1", Winners: []winner{winner1}}
+						postRequest(t, "/tournaments/1/start", nil)
+						postRequest(t, "/resultTournament", result)
+
+						Convey("Then the prize is paid proportionally to the stakes", func() {
+							_, body := getRequest(t, "/balance?playerId=P1")
+							So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1200)
+
+							_, body = getRequest(t, "/balance?playerId=P2")
+							So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1300)
+						})
+					})
+				})
+
+				Convey("When I join the tournament with player P1 and backer P2 with 40 percents stake", func() {
+					res, _ := getRequest(t, "/joinTournament?tournamentId=1&playerId=P1&backerId=P2:40%25")
+
+					Convey("Then I get 200 status code", func() {
+						So(res.StatusCode, ShouldEqual, 200)
+					})
+
+					Convey("And P1 pays 300 points and P2 pays 200 points", func() {
+						_, body := getRequest(t, "/balance?playerId=P1")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 700)
+
+						_, body = getRequest(t, "/balance?playerId=P2")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 800)
+					})
+				})
+
+				Convey("When I join the tournament with backer stake bigger than the deposit", func() {
+					res, _ := getRequest(t, "/joinTournament?tournamentId=1&playerId=P1&backerId=P2:600")
+
+					Convey("Then I get 400 status code", func() {
+						So(res.StatusCode, ShouldEqual, 400)
+					})
+
+					Convey("And nobody pays anything", func() {
+						_, body := getRequest(t, "/balance?playerId=P2")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+					})
+				})
+			})
+		})
+	})
+}
+
+func TestPlayerTransactions(t *testing.T) {
+	Convey("Test player transactions", t, func() {
+		resetDB(t)
+
+		Convey("When I call transactions of unexisting player", func() {
+			res, _ := getRequest(t, "/players/P1/transactions")
+
+			Convey("Then I get 404 status code", func() {
+				So(res.StatusCode, ShouldEqual, 404)
+			})
+		})
+
+		Convey("Given I fund P1 with 1000 points and P2 with 500 points", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/fund?playerId=P2&points=500")
+
+			Convey("And I take 100 points from P1 and join him to the tournament with backer P2", func() {
+				getRequest(t, "/take?playerId=P1&points=100")
+				getRequest(t, "/announceTournament?tournamentId=1&deposit=500")
+				getRequest(t, "/joinTournament?tournamentId=1&playerId=P1&backerId=P2")
+
+				Convey("When I call P1 transactions", func() {
+					res, body := getRequest(t, "/players/P1/transactions")
+					page := parseJSONTransactionsBody(t, body)
+
+					Convey("Then I get 200 status code", func() {
+						So(res.StatusCode, ShouldEqual, 200)
+					})
+
+					Convey("And I get 3 transactions, newest first", func() {
+						So(len(page.Transactions), ShouldEqual, 3)
+						So(page.Transactions[0].Type, ShouldEqual, "deposit")
+						So(page.Transactions[0].Amount, ShouldEqual, -250)
+						So(page.Transactions[0].TournamentID, ShouldEqual, 1)
+						So(page.Transactions[1].Type, ShouldEqual, "take")
+						So(page.Transactions[1].Amount, ShouldEqual, -100)
+						So(page.Transactions[2].Type, ShouldEqual, "fund")
+						So(page.Transactions[2].Amount, ShouldEqual, 1000)
+					})
+				})
+
+				Convey("When I call P1 transactions page by page", func() {
+					_, body := getRequest(t, "/players/P1/transactions?limit=2")
+					page := parseJSONTransactionsBody(t, body)
+
+					Convey("Then the first page has 2 transactions and a cursor", func() {
+						So(len(page.Transactions), ShouldEqual, 2)
+						So(page.NextCursor, ShouldNotEqual, 0)
+					})
+
+					Convey("And the next page has the last transaction only", func() {
+						_, body := getRequest(t, fmt.Sprintf("/players/P1/transactions?limit=2&cursor=%d", page.NextCursor))
+						nextPage := parseJSONTransactionsBody(t, body)
+
+						So(len(nextPage.Transactions), ShouldEqual, 1)
+						So(nextPage.Transactions[0].Type, ShouldEqual, "fund")
+						So(nextPage.NextCursor, ShouldEqual, 0)
+					})
+				})
+
+				Convey("When I call P2 deposit transactions", func() {
+					_, body := getRequest(t, "/players/P2/transactions?type=deposit")
+					page := parseJSONTransactionsBody(t, body)
+
+					Convey("Then I get his backer share of P1 deposit", func() {
+						So(len(page.Transactions), ShouldEqual, 1)
+						So(page.Transactions[0].AttendeeID, ShouldEqual, "P1")
+						So(page.Transactions[0].Amount, ShouldEqual, -250)
+					})
+				})
+
+				Convey("When I filter P1 transactions with unknown type", func() {
+					res, _ := getRequest(t, "/players/P1/transactions?type=unknown")
+
+					Convey("Then I get 400 status code", func() {
+						So(res.StatusCode, ShouldEqual, 400)
+					})
+				})
+
+				Convey("When I filter P1 transactions from the time later than to", func() {
+					res, body := getRequest(t, "/players/P1/transactions?from=2020-01-02T00:00:00Z&to=2020-01-01T00:00:00Z")
+
+					Convey("Then I get 400 status code with VALIDATION_FAILED code", func() {
+						So(res.StatusCode, ShouldEqual, 400)
+						So(parseJSONErrorBody(t, body).Code, ShouldEqual, "VALIDATION_FAILED")
+					})
+				})
+
+				Convey("When I request P1 transactions with zero limit", func() {
+					res, body := getRequest(t, "/players/P1/transactions?limit=0")
+
+					Convey("Then I get 200 status code and the default page", func() {
+						So(res.StatusCode, ShouldEqual, 200)
+						So(len(parseJSONTransactionsBody(t, body).Transactions), ShouldBeGreaterThan, 0)
+					})
+				})
+			})
+		})
+	})
+}
+
+func TestLedgerEntries(t *testing.T) {
+	Convey("Test ledger entries", t, func() {
+		resetDB(t)
+
+		Convey("When I fund P1 with 1000 points and take 300 points from him", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/take?playerId=P1&points=300")
+
+			_, body := getRequest(t, "/players/P1/transactions")
+			entries := parseJSONTransactionsBody(t, body).Transactions
+
+			Convey("Then P1 has the fund entry with positive amount and the take entry with negative amount", func() {
+				So(len(entries), ShouldEqual, 2)
+				So(entries[0].Type, ShouldEqual, models.EntryTake)
+				So(entries[0].Amount, ShouldEqual, -300)
+				So(entries[0].TournamentID, ShouldEqual, 0)
+				So(entries[1].Type, ShouldEqual, models.EntryFund)
+				So(entries[1].Amount, ShouldEqual, 1000)
+			})
+
+			Convey("And his entries sum up to his balance", func() {
+				_, body := getRequest(t, "/balance?playerId=P1")
+				So(ledgerSum(t, "P1"), ShouldEqual, parseJSONPlayerBody(t, body).Balance)
+			})
+		})
+
+		Convey("Given P1 with backer P2 joined the tournament 1 with 500 deposit", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/fund?playerId=P2&points=1000")
+			getRequest(t, "/announceTournament?tournamentId=1&deposit=500")
+			getRequest(t, "/joinTournament?tournamentId=1&playerId=P1&backerId=P2")
+
+			Convey("When I get the deposit entries of P1 and P2", func() {
+				_, body := getRequest(t, "/players/P1/transactions?type=deposit")
+				playerEntries := parseJSONTransactionsBody(t, body).Transactions
+				_, body = getRequest(t, "/players/P2/transactions?type=deposit")
+				backerEntries := parseJSONTransactionsBody(t, body).Transactions
+
+				Convey("Then every of them paid his stake in the tournament 1 for the attendee P1", func() {
+					So(len(playerEntries), ShouldEqual, 1)
+					So(playerEntries[0].Amount, ShouldEqual, -250)
+					So(playerEntries[0].TournamentID, ShouldEqual, 1)
+					So(playerEntries[0].AttendeeID, ShouldEqual, "P1")
+
+					So(len(backerEntries), ShouldEqual, 1)
+					So(backerEntries[0].Amount, ShouldEqual, -250)
+					So(backerEntries[0].TournamentID, ShouldEqual, 1)
+					So(backerEntries[0].AttendeeID, ShouldEqual, "P1")
+				})
+			})
+
+			Convey("When the tournament is finished with P1 winning 1000 points", func() {
+				postRequest(t, "/tournaments/1/start", nil)
+				postRequest(t, "/resultTournament", tournament{TournamentID: "1", Winners: []winner{{PlayerID: "P1", Prize: 1000}}})
+
+				_, body := getRequest(t, "/players/P2/transactions?type=prize")
+				backerEntries := parseJSONTransactionsBody(t, body).Transactions
+
+				Convey("Then the backer P2 has the prize entry of his share for the attendee P1", func() {
+					So(len(backerEntries), ShouldEqual, 1)
+					So(backerEntries[0].Amount, ShouldEqual, 500)
+					So(backerEntries[0].TournamentID, ShouldEqual, 1)
+					So(backerEntries[0].AttendeeID, ShouldEqual, "P1")
+				})
+
+				Convey("And the entries of both players sum up to their balances", func() {
+					for _, playerID := range []string{"P1", "P2"} {
+						_, body := getRequest(t, "/balance?playerId="+playerID)
+						So(ledgerSum(t, playerID), ShouldEqual, parseJSONPlayerBody(t, body).Balance)
+					}
+				})
+			})
+		})
+
+		Convey("Given P1 had 700 points before the ledger and got the opening entry for them", func() {
+			postRequest(t, "/v2/players", map[string]string{"playerId": "P1"})
+			_, err := util.DBConnect.Exec(`INSERT INTO player_balances (player_id, currency, amount) VALUES ('P1', 'points', 700);`)
+			So(err, ShouldBeNil)
+			_, err = util.DBConnect.Exec(`INSERT INTO ledger_entries (player_id, entry_type, currency, amount) VALUES ('P1', 'opening', 'points', 700);`)
+			So(err, ShouldBeNil)
+
+			Convey("When I fund P1 with 300 points", func() {
+				getRequest(t, "/fund?playerId=P1&points=300")
+
+				Convey("Then his entries including the opening one sum up to his balance", func() {
+					_, body := getRequest(t, "/players/P1/transactions?type=opening")
+					So(len(parseJSONTransactionsBody(t, body).Transactions), ShouldEqual, 1)
+
+					_, body = getRequest(t, "/balance?playerId=P1")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+					So(ledgerSum(t, "P1"), ShouldEqual, 1000)
+				})
+			})
+		})
+	})
+}
+
+func TestIdempotentRequests(t *testing.T) {
+	Convey("Test idempotent requests", t, func() {
+		resetDB(t)
+
+		Convey("When I fund P1 with 300 points twice with the same request ID", func() {
+			res1, _ := getRequest(t, "/fund?playerId=P1&points=300&requestId=R1")
+			res2, _ := getRequest(t, "/fund?playerId=P1&points=300&requestId=R1")
+
+			Convey("Then I get 200 status code both times", func() {
+				So(res1.StatusCode, ShouldEqual, 200)
+				So(res2.StatusCode, ShouldEqual, 200)
+			})
+
+			Convey("And the second response is a replay", func() {
+				So(res2.Header.Get("Idempotent-Replayed"), ShouldEqual, "true")
+			})
+
+			Convey("And P1 balance is equal to 300", func() {
+				_, body := getRequest(t, "/balance?playerId=P1")
+				balanceData := parseJSONPlayerBody(t, body)
+
+				So(balanceData.Balance, ShouldEqual, 300)
+			})
+
+			Convey("And when I fund P1 with another amount under the same request ID", func() {
+				res, _ := getRequest(t, "/fund?playerId=P1&points=500&requestId=R1")
+
+				Convey("Then I get 422 status code", func() {
+					So(res.StatusCode, ShouldEqual, 422)
+				})
+			})
+
+			Convey("And when I take points under the same request ID", func() {
+				res, _ := getRequest(t, "/take?playerId=P1&points=300&requestId=R1")
+
+				Convey("Then I get 422 status code", func() {
+					So(res.StatusCode, ShouldEqual, 422)
+				})
+			})
+		})
+
+		Convey("When I take points from unexisting player twice with the same request ID", func() {
+			res1, _ := getRequest(t, "/take?playerId=P1&points=300&requestId=R2")
+			res2, _ := getRequest(t, "/take?playerId=P1&points=300&requestId=R2")
+
+			Convey("Then I get the same 404 status code both times", func() {
+				So(res1.StatusCode, ShouldEqual, 404)
+				So(res2.StatusCode, ShouldEqual, 404)
+			})
+		})
+
+		Convey("When two clients fund P1 with the same request ID", func() {
+			cashierKey := createAPIKey(models.RoleCashier)
+			res1, _ := getRequest(t, "/fund?playerId=P1&points=300&requestId=R5")
+			res2, _ := request(t, http.MethodGet, "/fund?playerId=P1&points=500&requestId=R5", cashierKey, nil)
+
+			Convey("Then both requests are applied, as every client has its own request IDs", func() {
+				So(res1.StatusCode, ShouldEqual, 200)
+				So(res2.StatusCode, ShouldEqual, 200)
+				So(res2.Header.Get("Idempotent-Replayed"), ShouldEqual, "")
+
+				_, body := getRequest(t, "/balance?playerId=P1")
+				So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 800)
+			})
+		})
+
+		Convey("Given the request with the same request ID is in progress", func() {
+			key, err := models.FindAPIKey(apiKey)
+			So(err, ShouldBeNil)
+
+			hash := sha256.Sum256([]byte("GET /fund?playerId=P1&points=300\n"))
+			inProgress := models.IdempotencyKey{APIKeyID: key.ID, Key: "R3", RequestHash: hex.EncodeToString(hash[:])}
+			reserved, err := inProgress.Reserve()
+			So(err, ShouldBeNil)
+			So(reserved, ShouldBeTrue)
+
+			retried := make(chan *http.Response)
+			retry := func() {
+				go func() {
+					res, _ := getRequest(t, "/fund?playerId=P1&points=300&requestId=R3")
+					retried <- res
+				}()
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			Convey("When I retry it and the request crashes before its response is stored", func() {
+				retry()
+				So(inProgress.Release(), ShouldBeNil)
+				res := <-retried
+
+				Convey("Then the retry is applied, as nothing was applied by the crashed request", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+					So(res.Header.Get("Idempotent-Replayed"), ShouldEqual, "")
+
+					_, body := getRequest(t, "/balance?playerId=P1")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 300)
+				})
+			})
+
+			Convey("When I retry it and the request stores its response", func() {
+				retry()
+				inProgress.StatusCode = 200
+				inProgress.Response = []byte(`{"PlayerID":"P1","Balance":300}`)
+				So(inProgress.Save(), ShouldBeNil)
+				res := <-retried
+
+				Convey("Then the retry gets the stored response and is not applied", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+					So(res.Header.Get("Idempotent-Replayed"), ShouldEqual, "true")
+
+					res, _ := getRequest(t, "/balance?playerId=P1")
+					So(res.StatusCode, ShouldEqual, 404)
+				})
+			})
+
+			Convey("When I retry it and the request is not finished in 1 second", func() {
+				os.Setenv("IDEMPOTENCY_WAIT", "1")
+				defer os.Unsetenv("IDEMPOTENCY_WAIT")
+
+				res, body := getRequest(t, "/fund?playerId=P1&points=300&requestId=R3")
+				So(inProgress.Release(), ShouldBeNil)
+
+				Convey("Then I get 409 status code with IDEMPOTENCY_KEY_IN_PROGRESS code", func() {
+					So(res.StatusCode, ShouldEqual, 409)
+					So(parseJSONErrorBody(t, body).Code, ShouldEqual, "IDEMPOTENCY_KEY_IN_PROGRESS")
+				})
+			})
+		})
+
+		Convey("Given the idempotency keys live 1 second", func() {
+			os.Setenv("IDEMPOTENCY_KEY_TTL", "1")
+			defer os.Unsetenv("IDEMPOTENCY_KEY_TTL")
+
+			Convey("When I fund P1 with 300 points and repeat it with the same request ID after the key is expired", func() {
+				getRequest(t, "/fund?playerId=P1&points=300&requestId=R4")
+				time.Sleep(1100 * time.Millisecond)
+				res, _ := getRequest(t, "/fund?playerId=P1&points=300&requestId=R4")
+
+				Convey("Then the second request is not a replay and P1 is funded twice", func() {
+					So(res.Header.Get("Idempotent-Replayed"), ShouldEqual, "")
+
+					_, body := getRequest(t, "/balance?playerId=P1")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 600)
+				})
+			})
+		})
+	})
+}
+
+func TestV2API(t *testing.T) {
+	Convey("Test v2 API", t, func() {
+		resetDB(t)
+
+		Convey("When I call the legacy fund endpoint", func() {
+			res, _ := getRequest(t, "/fund?playerId=P1&points=100")
+
+			Convey("Then the response is marked as deprecated", func() {
+				So(res.Header.Get("Deprecation"), ShouldEqual, "true")
+			})
+		})
+
+		Convey("When I register P1 and P2, then fund P1 with 1000 points and P2 with 500 points", func() {
+			postRequest(t, "/v2/players", map[string]string{"playerId": "P1"})
+			postRequest(t, "/v2/players", map[string]string{"playerId": "P2"})
+			res, body := postRequest(t, "/v2/players/P1/fund", map[string]int{"points": 1000})
+			postRequest(t, "/v2/players/P2/fund", map[string]int{"points": 500})
+
+			Convey("Then I get 200 status code and P1 balance", func() {
+				So(res.StatusCode, ShouldEqual, 200)
+				So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+			})
+
+			Convey("And the response is not deprecated", func() {
+				So(res.Header.Get("Deprecation"), ShouldEqual, "")
+			})
+
+			Convey("And when I take 300 points from P1", func() {
+				res, body := postRequest(t, "/v2/players/P1/take", map[string]int{"points": 300})
+
+				Convey("Then I get 200 status code and P1 balance is equal to 700", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 700)
+				})
+			})
+
+			Convey("And when I create the tournament with ID 1 and 500 deposit", func() {
+				res, _ := postRequest(t, "/v2/tournaments", map[string]int{"tournamentId": 1, "deposit": 500})
+
+				Convey("Then I get 201 status code", func() {
+					So(res.StatusCode, ShouldEqual, 201)
+				})
+
+				Convey("And when I add P1 with backer P2 with 40 percents stake", func() {
+					attendee := map[string]interface{}{
+						"playerId": "P1",
+						"backers":  []map[string]interface{}{{"playerId": "P2", "percent": 40}},
+					}
+					res, _ := postRequest(t, "/v2/tournaments/1/attendees", attendee)
+
+					Convey("Then I get 201 status code", func() {
+						So(res.StatusCode, ShouldEqual, 201)
+					})
+
+					Convey("And P2 pays 200 points", func() {
+						_, body := getRequest(t, "/v2/players/P2")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 300)
+					})
+
+					Convey("And when I remove P1 from the tournament", func() {
+						res, _ := deleteRequest(t, "/v2/tournaments/1/attendees/P1")
+
+						Convey("Then I get 204 status code and P1 gets his deposit back", func() {
+							So(res.StatusCode, ShouldEqual, 204)
+
+							_, body := getRequest(t, "/v2/players/P1")
+							So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+						})
+					})
+
+					Convey("And when I start the tournament and post the result with P1 as a winner", func() {
+						postRequest(t, "/v2/tournaments/1/start", nil)
+						result := map[string][]winner{"winners": {{PlayerID: "P1", Prize: 500}}}
+						res, _ := postRequest(t, "/v2/tournaments/1/results", result)
+
+						Convey("Then I get 200 status code and the prize is paid", func() {
+							So(res.StatusCode, ShouldEqual, 200)
+
+							_, body := getRequest(t, "/v2/players/P1")
+							So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+
+							_, body = getRequest(t, "/v2/players/P2")
+							So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 500)
+						})
+					})
+
+					Convey("And when I close the registration, open it again and cancel the tournament", func() {
+						closeRes, _ := postRequest(t, "/v2/tournaments/1/close", nil)
+						openRes, _ := postRequest(t, "/v2/tournaments/1/open", nil)
+						res, _ := postRequest(t, "/v2/tournaments/1/cancel", nil)
+
+						Convey("Then I get 200 status codes and the deposits are refunded", func() {
+							So(closeRes.StatusCode, ShouldEqual, 200)
+							So(openRes.StatusCode, ShouldEqual, 200)
+							So(res.StatusCode, ShouldEqual, 200)
+
+							_, body := getRequest(t, "/v2/players/P2")
+							So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 500)
+						})
+
+						Convey("And the responses are not deprecated", func() {
+							So(res.Header.Get("Deprecation"), ShouldEqual, "")
+						})
+					})
+				})
+			})
+
+			Convey("And when I request P1 transactions", func() {
+				res, body := getRequest(t, "/v2/players/P1/transactions?type=fund")
+
+				Convey("Then I get 200 status code and the funding is listed", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+					So(len(parseJSONTransactionsBody(t, body).Transactions), ShouldEqual, 1)
+				})
+
+				Convey("And the legacy transactions endpoint is marked as deprecated", func() {
+					res, _ := getRequest(t, "/players/P1/transactions")
+					So(res.Header.Get("Deprecation"), ShouldEqual, "true")
+				})
+			})
+		})
+	})
+}
+
+func TestPlayerRegistry(t *testing.T) {
+	Convey("Test player registry", t, func() {
+		resetDB(t)
+
+		Convey("When I fund the unregistered player P1 with v2 API", func() {
+			res, _ := postRequest(t, "/v2/players/P1/fund", map[string]int{"points": 100})
+
+			Convey("Then I get 404 status code", func() {
+				So(res.StatusCode, ShouldEqual, 404)
+			})
+		})
+
+		Convey("When I register the player with invalid currency", func() {
+			res, body := postRequest(t, "/v2/players", map[string]string{"playerId": "P1", "currency": "euro"})
+
+			Convey("Then I get 400 status code with the invalid field", func() {
+				So(res.StatusCode, ShouldEqual, 400)
+				So(body, ShouldContainSubstring, "currency")
+			})
+		})
+
+		Convey("When I register P1 with the profile", func() {
+			profile := map[string]string{"playerId": "P1", "displayName": "Player One", "currency": "EUR", "region": "EU"}
+			res, body := postRequest(t, "/v2/players", profile)
+
+			Convey("Then I get 201 status code and the active player without points", func() {
+				So(res.StatusCode, ShouldEqual, 201)
+
+				player := parseJSONPlayerBody(t, body)
+				So(player.DisplayName, ShouldEqual, "Player One")
+				So(player.Status, ShouldEqual, "active")
+				So(player.Balance, ShouldEqual, 0)
+			})
+
+			Convey("And when I register P1 once again", func() {
+				res, body := postRequest(t, "/v2/players", map[string]string{"playerId": "P1"})
+
+				Convey("Then I get 400 status code", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+					So(parseJSONErrorBody(t, body).Code, ShouldEqual, "PLAYER_EXISTS")
+				})
+			})
+
+			Convey("And when I change the display name of P1", func() {
+				res, body := request(t, http.MethodPatch, "/v2/players/P1", apiKey, map[string]string{"displayName": "The One"})
+
+				Convey("Then I get 200 status code and the rest of the profile is kept", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+					So(parseJSONPlayerBody(t, body).DisplayName, ShouldEqual, "The One")
+					So(body, ShouldContainSubstring, `"currency":"EUR"`)
+				})
+			})
+
+			Convey("And when I fund P1 with 1000 points and suspend him", func() {
+				postRequest(t, "/v2/players/P1/fund", map[string]int{"points": 1000})
+				getRequest(t, "/announceTournament?tournamentId=1&deposit=500")
+				res, _ := request(t, http.MethodPatch, "/v2/players/P1", apiKey, map[string]string{"status": "suspended"})
+				So(res.StatusCode, ShouldEqual, 200)
+
+				Convey("Then P1 cannot be funded, taken from or join the tournament", func() {
+					res, body := postRequest(t, "/v2/players/P1/fund", map[string]int{"points": 100})
+					So(res.StatusCode, ShouldEqual, 403)
+					So(parseJSONErrorBody(t, body).Code, ShouldEqual, "PLAYER_NOT_ACTIVE")
+
+					res, _ = getRequest(t, "/fund?playerId=P1&points=100")
+					So(res.StatusCode, ShouldEqual, 403)
+
+					res, _ = postRequest(t, "/v2/players/P1/take", map[string]int{"points": 100})
+					So(res.StatusCode, ShouldEqual, 403)
+
+					res, _ = getRequest(t, "/joinTournament?tournamentId=1&playerId=P1")
+					So(res.StatusCode, ShouldEqual, 403)
+
+					_, body = getRequest(t, "/v2/players/P1")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+				})
+
+				Convey("And when I activate P1 again", func() {
+					request(t, http.MethodPatch, "/v2/players/P1", apiKey, map[string]string{"status": "active"})
+
+					Convey("Then P1 can be funded", func() {
+						res, body := postRequest(t, "/v2/players/P1/fund", map[string]int{"points": 100})
+						So(res.StatusCode, ShouldEqual, 200)
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1100)
+					})
+				})
+			})
+
+			Convey("And when I close P1", func() {
+				res, body := deleteRequest(t, "/v2/players/P1")
+
+				Convey("Then I get 200 status code and P1 is closed", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+					So(parseJSONPlayerBody(t, body).Status, ShouldEqual, "closed")
+				})
+
+				Convey("And P1 cannot be activated again", func() {
+					res, _ := request(t, http.MethodPatch, "/v2/players/P1", apiKey, map[string]string{"status": "active"})
+					So(res.StatusCode, ShouldEqual, 403)
+				})
+			})
+
+			Convey("And when I fund P1 with 100 points and close him", func() {
+				postRequest(t, "/v2/players/P1/fund", map[string]int{"points": 100})
+				res, body := deleteRequest(t, "/v2/players/P1")
+
+				Convey("Then I get 400 status code with PLAYER_HAS_FUNDS error and P1 is still active", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+					So(parseJSONErrorBody(t, body).Code, ShouldEqual, models.CodePlayerHasFunds)
+
+					_, body = getRequest(t, "/v2/players/P1")
+					So(parseJSONPlayerBody(t, body).Status, ShouldEqual, "active")
+				})
+
+				Convey("And when I take his points and close him again", func() {
+					postRequest(t, "/v2/players/P1/take", map[string]int{"points": 100})
+					res, _ := deleteRequest(t, "/v2/players/P1")
+
+					Convey("Then I get 200 status code", func() {
+						So(res.StatusCode, ShouldEqual, 200)
+					})
+				})
+			})
+
+			Convey("And when I fund P1 with 500 points, join him to the tournament with 500 deposit and close him", func() {
+				postRequest(t, "/v2/players/P1/fund", map[string]int{"points": 500})
+				postRequest(t, "/v2/tournaments", map[string]int{"tournamentId": 1, "deposit": 500})
+				postRequest(t, "/v2/tournaments/1/attendees", map[string]string{"playerId": "P1"})
+				res, body := deleteRequest(t, "/v2/players/P1")
+
+				Convey("Then I get 400 status code with PLAYER_HAS_FUNDS error, as his deposit could be refunded", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+					So(parseJSONErrorBody(t, body).Code, ShouldEqual, models.CodePlayerHasFunds)
+				})
+
+				Convey("And when P1 leaves the tournament, his points are taken and he is closed again", func() {
+					deleteRequest(t, "/v2/tournaments/1/attendees/P1")
+					postRequest(t, "/v2/players/P1/take", map[string]int{"points": 500})
+					res, _ := deleteRequest(t, "/v2/players/P1")
+
+					Convey("Then I get 200 status code", func() {
+						So(res.StatusCode, ShouldEqual, 200)
+					})
+				})
+			})
+
+			Convey("And when I fund P1 with 1000 points, join him to the tournament with 500 deposit and suspend him", func() {
+				postRequest(t, "/v2/players/P1/fund", map[string]int{"points": 1000})
+				postRequest(t, "/v2/tournaments", map[string]int{"tournamentId": 1, "deposit": 500})
+				postRequest(t, "/v2/tournaments/1/attendees", map[string]string{"playerId": "P1"})
+				request(t, http.MethodPatch, "/v2/players/P1", apiKey, map[string]string{"status": "suspended"})
+
+				Convey("And when the tournament is finished with P1 as a winner", func() {
+					postRequest(t, "/v2/tournaments/1/start", nil)
+					result := map[string][]winner{"winners": {{PlayerID: "P1", Prize: 500}}}
+					res, _ := postRequest(t, "/v2/tournaments/1/results", result)
+
+					Convey("Then the suspended P1 gets the prize, but it stays frozen", func() {
+						So(res.StatusCode, ShouldEqual, 200)
+
+						_, body := getRequest(t, "/v2/players/P1")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+
+						res, _ := postRequest(t, "/v2/players/P1/take", map[string]int{"points": 100})
+						So(res.StatusCode, ShouldEqual, 403)
+					})
+				})
+
+				Convey("And when the tournament is cancelled", func() {
+					postRequest(t, "/v2/tournaments/1/cancel", nil)
+
+					Convey("Then the suspended P1 gets his deposit back", func() {
+						_, body := getRequest(t, "/v2/players/P1")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+					})
+				})
+			})
+
+			Convey("And when I change the display name and the region of P1 at once many times", func() {
+				var wg sync.WaitGroup
+				for i := 0; i < 10; i++ {
+					wg.Add(2)
+					go func(i int) {
+						defer wg.Done()
+						request(t, http.MethodPatch, "/v2/players/P1", apiKey, map[string]string{"displayName": "Name " + strconv.Itoa(i)})
+					}(i)
+					go func(i int) {
+						defer wg.Done()
+						request(t, http.MethodPatch, "/v2/players/P1", apiKey, map[string]string{"region": "Region " + strconv.Itoa(i)})
+					}(i)
+				}
+				wg.Wait()
+
+				Convey("Then none of the changes is lost", func() {
+					_, body := getRequest(t, "/v2/players/P1")
+					player := parseJSONPlayerBody(t, body)
+					So(player.DisplayName, ShouldStartWith, "Name ")
+					So(player.Region, ShouldStartWith, "Region ")
+				})
+			})
+		})
+	})
+}
+
+func TestMultiCurrencyBalances(t *testing.T) {
+	Convey("Test balances in several currencies", t, func() {
+		resetDB(t)
+
+		Convey("Given I fund P1 with 1000 points and 500 bonus and P2 with 500 bonus", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/fund?playerId=P1&points=500&currency=bonus")
+			postRequest(t, "/v2/players/P2/fund", map[string]interface{}{"points": 500, "currency": "bonus"})
+
+			Convey("When I request P1 balance", func() {
+				_, body := getRequest(t, "/balance?playerId=P1")
+				player := parseJSONPlayerBody(t, body)
+
+				Convey("Then I get every balance separately", func() {
+					So(player.Balance, ShouldEqual, 1000)
+					So(player.Balances["points"], ShouldEqual, 1000)
+					So(player.Balances["bonus"], ShouldEqual, 500)
+				})
+			})
+
+			Convey("When I take 600 bonus from P1", func() {
+				res, _ := getRequest(t, "/take?playerId=P1&points=600&currency=bonus")
+
+				Convey("Then I get 400 status code and points are not used instead", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+
+					_, body := getRequest(t, "/balance?playerId=P1")
+					player := parseJSONPlayerBody(t, body)
+					So(player.Balances["points"], ShouldEqual, 1000)
+					So(player.Balances["bonus"], ShouldEqual, 500)
+				})
+			})
+
+			Convey("When I take 10 USD from P1 who has none", func() {
+				res, body := getRequest(t, "/take?playerId=P1&points=10&currency=USD")
+
+				Convey("Then I get 400 status code", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+					So(parseJSONErrorBody(t, body).Code, ShouldEqual, "INSUFFICIENT_FUNDS")
+				})
+			})
+
+			Convey("When I announce the bonus tournament with deposit 300 and P1 joins it backed by P2", func() {
+				getRequest(t, "/announceTournament?tournamentId=1&deposit=300&currency=bonus")
+				res, _ := getRequest(t, "/joinTournament?tournamentId=1&playerId=P1&backerId=P2")
+
+				Convey("Then the deposit is paid in bonus only", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+
+					_, body := getRequest(t, "/balance?playerId=P1")
+					player := parseJSONPlayerBody(t, body)
+					So(player.Balances["points"], ShouldEqual, 1000)
+					So(player.Balances["bonus"], ShouldEqual, 350)
+				})
+
+				Convey("And when P1 wins 300 prize", func() {
+					postRequest(t, "/tournaments/1/start", nil)
+					result := tournament{TournamentID: "1", Winners: []winner{{PlayerID: "P1", Prize: 300}}}
+					postRequest(t, "/resultTournament", result)
+
+					Convey("Then the prize is paid in bonus", func() {
+						_, body := getRequest(t, "/balance?playerId=P1")
+						player := parseJSONPlayerBody(t, body)
+						So(player.Balances["points"], ShouldEqual, 1000)
+						So(player.Balances["bonus"], ShouldEqual, 500)
+
+						_, body = getRequest(t, "/balance?playerId=P2")
+						So(parseJSONPlayerBody(t, body).Balances["bonus"], ShouldEqual, 500)
+					})
+				})
+			})
+		})
+	})
+}
+
+func TestBonusBalance(t *testing.T) {
+	defer os.Unsetenv("BONUS_FIRST")
+
+	Convey("Test bonus balance with wagering", t, func() {
+		resetDB(t)
+
+		Convey("Given I fund P1 with 1000 points and 200 bonus points", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/fund?playerId=P1&points=200&bucket=bonus")
+
+			Convey("When I take the bonus points from P1", func() {
+				res, _ := getRequest(t, "/take?playerId=P1&points=200&bucket=bonus")
+
+				Convey("Then I get 400 status code", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+				})
+			})
+
+			Convey("When I take 1100 points from P1", func() {
+				res, _ := getRequest(t, "/take?playerId=P1&points=1100")
+
+				Convey("Then I get 400 status code as only 1000 points are withdrawable", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+				})
+			})
+
+			Convey("When P1 joins the tournament with deposit 300", func() {
+				getRequest(t, "/announceTournament?tournamentId=1&deposit=300")
+				getRequest(t, "/joinTournament?tournamentId=1&playerId=P1")
+
+				Convey("Then the bonus is spent first", func() {
+					_, body := getRequest(t, "/balance?playerId=P1")
+					player := parseJSONPlayerBody(t, body)
+					So(player.Balance, ShouldEqual, 900)
+					So(player.Bonus["points"], ShouldEqual, 0)
+				})
+
+				Convey("And when P1 wins 300 prize", func() {
+					postRequest(t, "/tournaments/1/start", nil)
+					postRequest(t, "/resultTournament", tournament{TournamentID: "1", Winners: []winner{{PlayerID: "P1", Prize: 300}}})
+
+					Convey("Then the part won with the bonus is restricted until wagered", func() {
+						_, body := getRequest(t, "/balance?playerId=P1")
+						player := parseJSONPlayerBody(t, body)
+						So(player.Balance, ShouldEqual, 1000)
+						So(player.Restricted["points"], ShouldEqual, 200)
+						So(player.Wagering["points"], ShouldEqual, 200)
+
+						res, _ := getRequest(t, "/take?playerId=P1&points=1100")
+						So(res.StatusCode, ShouldEqual, 400)
+					})
+
+					Convey("And when P1 wagers 200 withdrawable points in the next tournament", func() {
+						os.Setenv("BONUS_FIRST", "false")
+						getRequest(t, "/fund?playerId=P2&points=500")
+						getRequest(t, "/announceTournament?tournamentId=2&deposit=200")
+						getRequest(t, "/joinTournament?tournamentId=2&playerId=P1")
+						getRequest(t, "/joinTournament?tournamentId=2&playerId=P2")
+						postRequest(t, "/tournaments/2/start", nil)
+						postRequest(t, "/resultTournament", tournament{TournamentID: "2", Winners: []winner{{PlayerID: "P2", Prize: 400}}})
+
+						Convey("Then the restricted prize becomes withdrawable", func() {
+							_, body := getRequest(t, "/balance?playerId=P1")
+							player := parseJSONPlayerBody(t, body)
+							So(player.Balance, ShouldEqual, 1000)
+							So(player.Restricted["points"], ShouldEqual, 0)
+							So(player.Wagering["points"], ShouldEqual, 0)
+
+							res, _ := getRequest(t, "/take?playerId=P1&points=1000")
+							So(res.StatusCode, ShouldEqual, 200)
+						})
+					})
+				})
+			})
+		})
+	})
+}
+
+func TestBalanceHolds(t *testing.T) {
+	Convey("Test balance holds", t, func() {
+		resetDB(t)
+
+		Convey("Given I fund P1 with 1000 points and hold 700 of them", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			res, body := postRequest(t, "/v2/players/P1/holds", map[string]interface{}{"amount": 700, "reason": "withdrawal"})
+			hold := parseJSONHoldBody(t, body)
+
+			Convey("Then I get 201 status code and the active hold", func() {
+				So(res.StatusCode, ShouldEqual, 201)
+				So(hold.Status, ShouldEqual, "active")
+			})
+
+			Convey("And P1 balance shows available and held points", func() {
+				_, body := getRequest(t, "/balance?playerId=P1")
+				player := parseJSONPlayerBody(t, body)
+				So(player.Balances["points"], ShouldEqual, 1000)
+				So(player.Held["points"], ShouldEqual, 700)
+				So(player.Available["points"], ShouldEqual, 300)
+			})
+
+			Convey("When I take 400 points or join P1 to the tournament with deposit 500", func() {
+				takeRes, _ := getRequest(t, "/take?playerId=P1&points=400")
+				getRequest(t, "/announceTournament?tournamentId=1&deposit=500")
+				joinRes, _ := getRequest(t, "/joinTournament?tournamentId=1&playerId=P1")
+
+				Convey("Then I get 400 status code as only available points are used", func() {
+					So(takeRes.StatusCode, ShouldEqual, 400)
+					So(joinRes.StatusCode, ShouldEqual, 400)
+				})
+			})
+
+			Convey("When I hold 400 points more", func() {
+				res, _ := postRequest(t, "/v2/players/P1/holds", map[string]interface{}{"amount": 400})
+
+				Convey("Then I get 400 status code", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+				})
+			})
+
+			Convey("When I capture the hold", func() {
+				res, _ := postRequest(t, fmt.Sprintf("/v2/holds/%d/capture", hold.ID), nil)
+
+				Convey("Then I get 200 status code and the held points are taken", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+
+					_, body := getRequest(t, "/balance?playerId=P1")
+					player := parseJSONPlayerBody(t, body)
+					So(player.Balances["points"], ShouldEqual, 300)
+					So(player.Available["points"], ShouldEqual, 300)
+				})
+
+				Convey("And the hold cannot be captured or released once again", func() {
+					res, body := postRequest(t, fmt.Sprintf("/v2/holds/%d/release", hold.ID), nil)
+					So(res.StatusCode, ShouldEqual, 400)
+					So(parseJSONErrorBody(t, body).Code, ShouldEqual, "HOLD_NOT_ACTIVE")
+				})
+			})
+
+			Convey("When I release the hold", func() {
+				res, _ := postRequest(t, fmt.Sprintf("/v2/holds/%d/release", hold.ID), nil)
+
+				Convey("Then I get 200 status code and every point is available", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+
+					res, _ := getRequest(t, "/take?playerId=P1&points=1000")
+					So(res.StatusCode, ShouldEqual, 200)
+				})
+			})
+		})
+
+		Convey("Given I fund P1 with 1000 points and hold 700 of them for 1 second", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			_, body := postRequest(t, "/v2/players/P1/holds", map[string]interface{}{"amount": 700, "expiresIn": 1})
+			hold := parseJSONHoldBody(t, body)
+
+			Convey("When the hold expires", func() {
+				time.Sleep(2 * time.Second)
+
+				Convey("Then it is reported as expired and cannot be captured", func() {
+					_, body := getRequest(t, fmt.Sprintf("/v2/holds/%d", hold.ID))
+					So(parseJSONHoldBody(t, body).Status, ShouldEqual, "expired")
+
+					res, _ := postRequest(t, fmt.Sprintf("/v2/holds/%d/capture", hold.ID), nil)
+					So(res.StatusCode, ShouldEqual, 400)
+				})
+
+				Convey("And every point is available again", func() {
+					_, body := getRequest(t, "/balance?playerId=P1")
+					So(parseJSONPlayerBody(t, body).Available["points"], ShouldEqual, 1000)
+				})
+			})
+		})
+	})
+}
+
+func TestPlayersBatch(t *testing.T) {
+	Convey("Test players batch", t, func() {
+		resetDB(t)
+
+		Convey("Given I fund P1 with 1000 points and P2 with 500 points", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/fund?playerId=P2&points=500")
+
+			operations := []map[string]interface{}{
+				{"operation": "fund", "playerId": "P1", "points": 100},
+				{"operation": "take", "playerId": "P2", "points": 600},
+			}
+
+			Convey("When I apply the atomic batch with the failing operation", func() {
+				res, body := postRequest(t, "/v2/players/batch", map[string]interface{}{"operations": operations})
+
+				Convey("Then I get 400 status code with the failed operation", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+					So(parseJSONErrorBody(t, body).Code, ShouldEqual, "INSUFFICIENT_FUNDS")
+					So(body, ShouldContainSubstring, "operations[1]")
+				})
+
+				Convey("And nothing is applied", func() {
+					_, body := getRequest(t, "/balance?playerId=P1")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+				})
+			})
+
+			Convey("When I apply the best-effort batch with the failing operation", func() {
+				res, body := postRequest(t, "/v2/players/batch", map[string]interface{}{"mode": "bestEffort", "operations": operations})
+
+				var results batchResults
+				if err := json.Unmarshal([]byte(body), &results); err != nil {
+					t.Fatal(err)
+				}
+
+				Convey("Then I get 200 status code with the result of every operation", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+					So(results.Succeeded, ShouldEqual, 1)
+					So(results.Failed, ShouldEqual, 1)
+					So(results.Results[0].Status, ShouldEqual, "ok")
+					So(results.Results[1].Status, ShouldEqual, "failed")
+					So(results.Results[1].Error.Code, ShouldEqual, "INSUFFICIENT_FUNDS")
+				})
+
+				Convey("And only the valid operation is applied", func() {
+					_, body := getRequest(t, "/balance?playerId=P1")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1100)
+
+					_, body = getRequest(t, "/balance?playerId=P2")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 500)
+				})
+			})
+
+			Convey("When I apply the atomic batch where P2 is funded before the take", func() {
+				operations := []map[string]interface{}{
+					{"operation": "fund", "playerId": "P2", "points": 100},
+					{"operation": "take", "playerId": "P1", "points": 200},
+					{"operation": "take", "playerId": "P2", "points": 600},
+				}
+				res, _ := postRequest(t, "/v2/players/batch", map[string]interface{}{"operations": operations})
+
+				Convey("Then I get 200 status code and every operation is applied in order", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+
+					_, body := getRequest(t, "/balance?playerId=P1")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 800)
+
+					_, body = getRequest(t, "/balance?playerId=P2")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 0)
+				})
+			})
+		})
+	})
+}
+
+func TestTransfers(t *testing.T) {
+	Convey("Test transfers", t, func() {
+		resetDB(t)
+
+		Convey("Given I fund P1 with 1000 points and P2 with 100 points", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/fund?playerId=P2&points=100")
+
+			Convey("When I transfer 300 points from P1 to P2", func() {
+				transfer := map[string]interface{}{"fromPlayerId": "P1", "toPlayerId": "P2", "amount": 300, "reference": "debt"}
+				res, _ := postRequest(t, "/v2/transfers", transfer)
+
+				Convey("Then I get 201 status code and the points are moved", func() {
+					So(res.StatusCode, ShouldEqual, 201)
+
+					_, body := getRequest(t, "/balance?playerId=P1")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 700)
+
+					_, body = getRequest(t, "/balance?playerId=P2")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 400)
+				})
+
+				Convey("And the transfer is recorded in the history of both players", func() {
+					_, body := getRequest(t, "/players/P1/transactions?type=transfer")
+					sent := parseJSONTransactionsBody(t, body)
+					So(len(sent.Transactions), ShouldEqual, 1)
+					So(sent.Transactions[0].Amount, ShouldEqual, -300)
+
+					_, body = getRequest(t, "/players/P2/transactions?type=transfer")
+					received := parseJSONTransactionsBody(t, body)
+					So(len(received.Transactions), ShouldEqual, 1)
+					So(received.Transactions[0].TransferID, ShouldEqual, sent.Transactions[0].TransferID)
+				})
+			})
+
+			Convey("When I transfer more points than P1 has", func() {
+				res, _ := postRequest(t, "/v2/transfers", map[string]interface{}{"fromPlayerId": "P1", "toPlayerId": "P2", "amount": 1001})
+
+				Convey("Then I get 400 status code and nothing is moved", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+
+					_, body := getRequest(t, "/balance?playerId=P1")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+				})
+			})
+
+			Convey("When I transfer points to the unknown player", func() {
+				res, _ := postRequest(t, "/v2/transfers", map[string]interface{}{"fromPlayerId": "P1", "toPlayerId": "P3", "amount": 100})
+
+				Convey("Then I get 404 status code and nothing is moved", func() {
+					So(res.StatusCode, ShouldEqual, 404)
+
+					_, body := getRequest(t, "/balance?playerId=P1")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+				})
+			})
+
+			Convey("When I transfer points from P1 to himself", func() {
+				res, _ := postRequest(t, "/v2/transfers", map[string]interface{}{"fromPlayerId": "P1", "toPlayerId": "P1", "amount": 100})
+
+				Convey("Then I get 400 status code", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+				})
+			})
+		})
+	})
+}
+
+func TestTournamentQueries(t *testing.T) {
+	Convey("Test tournament queries", t, func() {
+		resetDB(t)
+
+		Convey("Given P1 with backer P2 joined the tournament 1 with 1000 deposit, and P3 joined it alone", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/fund?playerId=P2&points=1000")
+			getRequest(t, "/fund?playerId=P3&points=1000")
+			getRequest(t, "/announceTournament?tournamentId=1&deposit=1000")
+			getRequest(t, "/joinTournament?tournamentId=1&playerId=P1&backerId=P2:30%")
+			getRequest(t, "/joinTournament?tournamentId=1&playerId=P3")
+
+			Convey("When I get the tournament 1", func() {
+				res, body := getRequest(t, "/v2/tournaments/1")
+				tournament := parseJSONTournamentBody(t, body)
+
+				Convey("Then I get 200 status code, 2 attendees and the pool of 2000 points", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+					So(tournament.Deposit, ShouldEqual, 1000)
+					So(tournament.Status, ShouldEqual, models.TournamentAnnounced)
+					So(tournament.AttendeesCount, ShouldEqual, 2)
+					So(tournament.Pool, ShouldEqual, 2000)
+					So(len(tournament.Results), ShouldEqual, 0)
+				})
+			})
+
+			Convey("When I get the attendees of the tournament 1", func() {
+				res, body := getRequest(t, "/v2/tournaments/1/attendees")
+				attendees := parseJSONAttendeesBody(t, body)
+
+				Convey("Then I get 200 status code and every attendee with his backers and stakes", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+					So(len(attendees), ShouldEqual, 2)
+					So(attendees[0].PlayerID, ShouldEqual, "P1")
+					So(attendees[0].Stake, ShouldEqual, 700)
+					So(attendees[0].Backers, ShouldResemble, []string{"P2"})
+					So(attendees[0].BackerStakes, ShouldResemble, []int{300})
+					So(attendees[1].PlayerID, ShouldEqual, "P3")
+					So(len(attendees[1].Backers), ShouldEqual, 0)
+				})
+			})
+
+			Convey("When the tournament is finished with P1 as a winner and I get it", func() {
+				postRequest(t, "/tournaments/1/start", nil)
+				postRequest(t, "/resultTournament", tournament{TournamentID: "1", Winners: []winner{{PlayerID: "P1", Prize: 2000}}})
+				_, body := getRequest(t, "/v2/tournaments/1")
+				finished := parseJSONTournamentBody(t, body)
+
+				Convey("Then the tournament is finished and the paid prize is in the results", func() {
+					So(finished.Status, ShouldEqual, models.TournamentFinished)
+					So(finished.Results, ShouldResemble, []winner{{PlayerID: "P1", Prize: 2000}})
+				})
+			})
+
+			Convey("And given the tournaments 2 and 3 are announced and the tournament 3 is cancelled", func() {
+				getRequest(t, "/announceTournament?tournamentId=2&deposit=100")
+				getRequest(t, "/announceTournament?tournamentId=3&deposit=100")
+				postRequest(t, "/v2/tournaments/3/cancel", nil)
+
+				Convey("When I list the announced tournaments", func() {
+					res, body := getRequest(t, "/v2/tournaments?status=announced")
+					page := parseJSONTournamentsBody(t, body)
+
+					Convey("Then I get 200 status code and the tournaments 2 and 1, newest first", func() {
+						So(res.StatusCode, ShouldEqual, 200)
+						So(len(page.Tournaments), ShouldEqual, 2)
+						So(page.Tournaments[0].TournamentID, ShouldEqual, 2)
+						So(page.Tournaments[1].TournamentID, ShouldEqual, 1)
+						So(page.Tournaments[1].AttendeesCount, ShouldEqual, 2)
+					})
+				})
+
+				Convey("When I list the tournaments 2 per page", func() {
+					_, body := getRequest(t, "/v2/tournaments?limit=2")
+					first := parseJSONTournamentsBody(t, body)
+					_, body = getRequest(t, "/v2/tournaments?limit=2&cursor="+strconv.Itoa(first.NextCursor))
+					second := parseJSONTournamentsBody(t, body)
+
+					Convey("Then I get every tournament once", func() {
+						So(len(first.Tournaments), ShouldEqual, 2)
+						So(first.NextCursor, ShouldEqual, 2)
+						So(len(second.Tournaments), ShouldEqual, 1)
+						So(second.Tournaments[0].TournamentID, ShouldEqual, 1)
+						So(second.NextCursor, ShouldEqual, 0)
+					})
+				})
+
+				Convey("When I list the tournaments with unknown status", func() {
+					res, _ := getRequest(t, "/v2/tournaments?status=lost")
+
+					Convey("Then I get 400 status code", func() {
+						So(res.StatusCode, ShouldEqual, 400)
+					})
+				})
+			})
+		})
+
+		Convey("When I get the unknown tournament or its attendees", func() {
+			res, _ := getRequest(t, "/v2/tournaments/42")
+			attendeesRes, _ := getRequest(t, "/v2/tournaments/42/attendees")
+
+			Convey("Then I get 404 status code", func() {
+				So(res.StatusCode, ShouldEqual, 404)
+				So(attendeesRes.StatusCode, ShouldEqual, 404)
+			})
+		})
+	})
+}
+
+func TestTournamentDetails(t *testing.T) {
+	Convey("Test tournament details", t, func() {
+		resetDB(t)
+
+		startsAt := time.Date(2030, time.January, 2, 15, 0, 0, 0, time.UTC)
+		details := map[string]interface{}{
+			"deposit":      100,
+			"name":         "Sunday Million",
+			"gameType":     "holdem",
+			"startsAt":     startsAt,
+			"maxAttendees": 100,
+			"minAttendees": 2,
+		}
+
+		Convey("When I create the tournament without ID", func() {
+			res, body := postRequest(t, "/v2/tournaments", details)
+			created := parseJSONTournamentBody(t, body)
+
+			Convey("Then I get 201 status code and the allocated ID", func() {
+				So(res.StatusCode, ShouldEqual, 201)
+				So(created.TournamentID, ShouldBeGreaterThan, 0)
+			})
+
+			Convey("And when I get the tournament by the allocated ID", func() {
+				_, body := getRequest(t, "/v2/tournaments/"+strconv.Itoa(created.TournamentID))
+				found := parseJSONTournamentBody(t, body)
+
+				Convey("Then it has every detail I passed", func() {
+					So(found.Name, ShouldEqual, "Sunday Million")
+					So(found.GameType, ShouldEqual, "holdem")
+					So(found.StartsAt.Equal(startsAt), ShouldBeTrue)
+					So(found.MaxAttendees, ShouldEqual, 100)
+					So(found.MinAttendees, ShouldEqual, 2)
+				})
+			})
+
+			Convey("And when I create the tournament with the ID after the allocated one and then one more without ID", func() {
+				explicitID := created.TournamentID + 10
+				res, _ := postRequest(t, "/v2/tournaments", map[string]int{"tournamentId": explicitID, "deposit": 100})
+				_, body := postRequest(t, "/v2/tournaments", map[string]int{"deposit": 100})
+
+				Convey("Then both are created and the next allocated ID goes after the passed one", func() {
+					So(res.StatusCode, ShouldEqual, 201)
+					So(parseJSONTournamentBody(t, body).TournamentID, ShouldBeGreaterThan, explicitID)
+				})
+			})
+		})
+
+		Convey("When I create two tournaments without ID", func() {
+			_, body := postRequest(t, "/v2/tournaments", map[string]int{"deposit": 100})
+			first := parseJSONTournamentBody(t, body)
+			_, body = postRequest(t, "/v2/tournaments", map[string]int{"deposit": 100})
+			second := parseJSONTournamentBody(t, body)
+
+			Convey("Then they get different IDs", func() {
+				So(second.TournamentID, ShouldNotEqual, first.TournamentID)
+			})
+		})
+
+		Convey("When I create the tournament with more min attendees than max attendees", func() {
+			res, _ := postRequest(t, "/v2/tournaments", map[string]int{"deposit": 100, "maxAttendees": 2, "minAttendees": 3})
+
+			Convey("Then I get 400 status code", func() {
+				So(res.StatusCode, ShouldEqual, 400)
+			})
+		})
+
+		Convey("When I announce the tournament without ID with the legacy endpoint", func() {
+			res, _ := getRequest(t, "/announceTournament?deposit=100")
+
+			Convey("Then I get 400 status code", func() {
+				So(res.StatusCode, ShouldEqual, 400)
+			})
+		})
+	})
+}
+
+func TestTournamentWaitlist(t *testing.T) {
+	Convey("Test tournament waitlist", t, func() {
+		resetDB(t)
+
+		Convey("Given P1 and P2 joined the tournament 1 with 100 deposit and 2 seats", func() {
+			for _, playerID := range []string{"P1", "P2", "P3", "P4"} {
+				getRequest(t, "/fund?playerId="+playerID+"&points=1000")
+			}
+			postRequest(t, "/v2/tournaments", map[string]int{"tournamentId": 1, "deposit": 100, "maxAttendees": 2})
+			getRequest(t, "/joinTournament?tournamentId=1&playerId=P1")
+			getRequest(t, "/joinTournament?tournamentId=1&playerId=P2")
+
+			Convey("When P3 joins the tournament", func() {
+				res, body := postRequest(t, "/v2/tournaments/1/attendees", map[string]string{"playerId": "P3"})
+
+				Convey("Then I get 400 status code and TOURNAMENT_FULL error", func() {
+					So(res.StatusCode, ShouldEqual, 400)
+					So(parseJSONErrorBody(t, body).Code, ShouldEqual, models.CodeTournamentFull)
+				})
+			})
+
+			Convey("When P3 and then P4 join the waitlist", func() {
+				res, body := postRequest(t, "/v2/tournaments/1/attendees", map[string]interface{}{"playerId": "P3", "waitlist": true})
+				getRequest(t, "/joinTournament?tournamentId=1&playerId=P4&waitlist=true")
+
+				Convey("Then I get 201 status code, P3 is waitlisted and is not charged", func() {
+					So(res.StatusCode, ShouldEqual, 201)
+					So(body, ShouldContainSubstring, `"waitlisted":true`)
+
+					_, body := getRequest(t, "/balance?playerId=P3")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+				})
+
+				Convey("And when P3 joins the waitlist second time", func() {
+					res, _ := postRequest(t, "/v2/tournaments/1/attendees", map[string]interface{}{"playerId": "P3", "waitlist": true})
+
+					Convey("Then I get 400 status code", func() {
+						So(res.StatusCode, ShouldEqual, 400)
+					})
+				})
+
+				Convey("And when P1 leaves the tournament", func() {
+					res, _ := deleteRequest(t, "/v2/tournaments/1/attendees/P1")
+
+					Convey("Then I get 204 status code and P3 takes the seat paying the deposit", func() {
+						So(res.StatusCode, ShouldEqual, 204)
+
+						_, body := getRequest(t, "/v2/tournaments/1/attendees")
+						attendees := parseJSONAttendeesBody(t, body)
+						So(len(attendees), ShouldEqual, 2)
+						So(attendees[1].PlayerID, ShouldEqual, "P3")
+
+						_, body = getRequest(t, "/balance?playerId=P3")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 900)
+
+						_, body = getRequest(t, "/balance?playerId=P4")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+					})
+				})
+
+				Convey("And when P3 spends his points and P1 leaves the tournament", func() {
+					getRequest(t, "/take?playerId=P3&points=1000")
+					deleteRequest(t, "/v2/tournaments/1/attendees/P1")
+
+					Convey("Then P3 is dropped from the waitlist and P4 takes the seat", func() {
+						_, body := getRequest(t, "/v2/tournaments/1/attendees")
+						attendees := parseJSONAttendeesBody(t, body)
+						So(len(attendees), ShouldEqual, 2)
+						So(attendees[1].PlayerID, ShouldEqual, "P4")
+
+						_, body = getRequest(t, "/balance?playerId=P4")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 900)
+					})
+				})
+
+				Convey("And when the registration is closed and P1 leaves the tournament", func() {
+					postRequest(t, "/v2/tournaments/1/close", nil)
+					res, _ := deleteRequest(t, "/v2/tournaments/1/attendees/P1")
+
+					Convey("Then I get 204 status code and nobody takes the seat", func() {
+						So(res.StatusCode, ShouldEqual, 204)
+
+						_, body := getRequest(t, "/v2/tournaments/1/attendees")
+						So(len(parseJSONAttendeesBody(t, body)), ShouldEqual, 1)
+
+						_, body = getRequest(t, "/balance?playerId=P3")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+					})
+
+					Convey("And when the registration is opened again and P2 leaves the tournament", func() {
+						postRequest(t, "/v2/tournaments/1/open", nil)
+						deleteRequest(t, "/v2/tournaments/1/attendees/P2")
+
+						Convey("Then the waitlist is dropped and nobody takes the seat", func() {
+							_, body := getRequest(t, "/v2/tournaments/1/attendees")
+							So(len(parseJSONAttendeesBody(t, body)), ShouldEqual, 0)
+						})
+					})
+				})
+
+				Convey("And when P3 leaves the waitlist and P1 leaves the tournament", func() {
+					res, _ := deleteRequest(t, "/v2/tournaments/1/attendees/P3")
+					deleteRequest(t, "/v2/tournaments/1/attendees/P1")
+
+					Convey("Then I get 204 status code, P3 is not charged and P4 takes the seat", func() {
+						So(res.StatusCode, ShouldEqual, 204)
+
+						_, body := getRequest(t, "/balance?playerId=P3")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+
+						_, body = getRequest(t, "/balance?playerId=P4")
+						So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 900)
+					})
+				})
+			})
+		})
+	})
+}
+
+func TestTournamentScheduler(t *testing.T) {
+	Convey("Test tournament scheduler", t, func() {
+		resetDB(t)
+
+		started := time.Now().Add(-time.Minute)
+		starting := time.Now().Add(time.Hour)
+
+		Convey("Given the started tournament 1 with P1 only, the started tournament 2 with P1 and P2, the future tournament 3 "+
+			"and the started tournament 4 with P1 only and the registration closed by the operator, every with 2 min attendees", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/fund?playerId=P2&points=1000")
+
+			for id, startsAt := range map[int]time.Time{1: started, 2: started, 3: starting, 4: started} {
+				tournament := map[string]interface{}{"tournamentId": id, "deposit": 100, "minAttendees": 2, "startsAt": startsAt}
+				postRequest(t, "/v2/tournaments", tournament)
+			}
+			getRequest(t, "/joinTournament?tournamentId=1&playerId=P1")
+			getRequest(t, "/joinTournament?tournamentId=2&playerId=P1")
+			getRequest(t, "/joinTournament?tournamentId=2&playerId=P2")
+			getRequest(t, "/joinTournament?tournamentId=4&playerId=P1")
+			postRequest(t, "/tournaments/4/close", nil)
+
+			Convey("When the scheduler processes the due tournaments", func() {
+				processed, err := models.ProcessDueTournaments()
+
+				Convey("Then the started tournaments are processed", func() {
+					So(err, ShouldBeNil)
+					So(processed, ShouldEqual, 3)
+				})
+
+				Convey("And the tournament 1 is cancelled and P1 gets his deposit back", func() {
+					_, body := getRequest(t, "/v2/tournaments/1")
+					So(parseJSONTournamentBody(t, body).Status, ShouldEqual, models.TournamentCancelled)
+
+					_, body = getRequest(t, "/balance?playerId=P1")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 900)
+				})
+
+				Convey("And the registration of the tournament 2 is closed", func() {
+					_, body := getRequest(t, "/v2/tournaments/2")
+					So(parseJSONTournamentBody(t, body).Status, ShouldEqual, models.TournamentRegistrationClosed)
+				})
+
+				Convey("And the tournament 3 is still announced", func() {
+					_, body := getRequest(t, "/v2/tournaments/3")
+					So(parseJSONTournamentBody(t, body).Status, ShouldEqual, models.TournamentAnnounced)
+				})
+
+				Convey("And the tournament 4 with the closed registration is cancelled too", func() {
+					_, body := getRequest(t, "/v2/tournaments/4")
+					So(parseJSONTournamentBody(t, body).Status, ShouldEqual, models.TournamentCancelled)
+				})
+
+				Convey("And the next time nothing is processed, as the tournament 2 has enough attendees", func() {
+					processed, err := models.ProcessDueTournaments()
+					So(err, ShouldBeNil)
+					So(processed, ShouldEqual, 0)
+				})
+			})
+
+			Convey("When several replicas process the due tournaments at once", func() {
+				var wg sync.WaitGroup
+				var mutex sync.Mutex
+				total := 0
+
+				for i := 0; i < 5; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+
+						processed, _ := models.ProcessDueTournaments()
+						mutex.Lock()
+						total += processed
+						mutex.Unlock()
+					}()
+				}
+				wg.Wait()
+
+				Convey("Then every tournament is processed once and P1 is refunded once", func() {
+					So(total, ShouldEqual, 3)
+
+					_, body := getRequest(t, "/balance?playerId=P1")
+					So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 900)
+				})
+			})
+		})
+	})
+}
+
+func TestTournamentResults(t *testing.T) {
+	Convey("Test tournament results", t, func() {
+		resetDB(t)
+
+		Convey("Given P1 with backer P2 with 30 percents stake and P3 with the bonus joined the tournament 1 with 1000 deposit", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/fund?playerId=P2&points=1000")
+			getRequest(t, "/fund?playerId=P3&points=1000&bucket=bonus")
+			getRequest(t, "/announceTournament?tournamentId=1&deposit=1000")
+			getRequest(t, "/joinTournament?tournamentId=1&playerId=P1&backerId=P2:30%")
+			getRequest(t, "/joinTournament?tournamentId=1&playerId=P3")
+			postRequest(t, "/tournaments/1/start", nil)
+
+			Convey("When I get the results of the running tournament", func() {
+				res, body := getRequest(t, "/v2/tournaments/1/results")
+
+				Convey("Then I get 200 status code and no results", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+					So(len(parseJSONResultsBody(t, body)), ShouldEqual, 0)
+				})
+			})
+
+			Convey("When the tournament is finished with P1 winning 1500 and P3 winning 500, and I get the results", func() {
+				result := tournament{TournamentID: "1", Winners: []winner{{PlayerID: "P1", Prize: 1500}, {PlayerID: "P3", Prize: 500}}}
+				postRequest(t, "/resultTournament", result)
+
+				res, body := getRequest(t, "/v2/tournaments/1/results")
+				results := parseJSONResultsBody(t, body)
+
+				Convey("Then I get 200 status code and the winners in the submitted order", func() {
+					So(res.StatusCode, ShouldEqual, 200)
+					So(len(results), ShouldEqual, 2)
+					So(results[0].PlayerID, ShouldEqual, "P1")
+					So(results[0].Position, ShouldEqual, 1)
+					So(results[0].Prize, ShouldEqual, 1500)
+					So(results[1].PlayerID, ShouldEqual, "P3")
+					So(results[1].Position, ShouldEqual, 2)
+				})
+
+				Convey("And the prize of P1 is paid to him and his backer in proportion to their stakes", func() {
+					So(results[0].Payouts, ShouldResemble, []payout{{PlayerID: "P1", Amount: 1050}, {PlayerID: "P2", Amount: 450}})
+				})
+
+				Convey("And the prize of P3 won with the bonus is restricted", func() {
+					So(results[1].Payouts, ShouldResemble, []payout{{PlayerID: "P3", Amount: 500, Restricted: 500}})
+				})
+			})
+		})
+
+		Convey("When I get the results of the unknown tournament", func() {
+			res, _ := getRequest(t, "/v2/tournaments/42/results")
+
+			Convey("Then I get 404 status code", func() {
+				So(res.StatusCode, ShouldEqual, 404)
+			})
+		})
+	})
+}
+
+func TestConcurrentTransfers(t *testing.T) {
+	Convey("Test opposite transfers concurrently", t, func() {
+		resetDB(t)
+
+		Convey("Given I fund P1 and P2 with 1000 points and transfer 10 points between them 10 times each way", func() {
+			getRequest(t, "/fund?playerId=P1&points=1000")
+			getRequest(t, "/fund?playerId=P2&points=1000")
+
+			const requestsCount = 10
+			responses := make(chan int, 2*requestsCount)
+
+			var wg sync.WaitGroup
+			for i := 1; i <= requestsCount; i++ {
+				for _, ids := range [][]string{{"P1", "P2"}, {"P2", "P1"}} {
+					wg.Add(1)
+					go func(from, to string) {
+						defer wg.Done()
+						res, _ := postRequest(t, "/v2/transfers", map[string]interface{}{"fromPlayerId": from, "toPlayerId": to, "amount": 10})
+						responses <- res.StatusCode
+					}(ids[0], ids[1])
+				}
+			}
+			wg.Wait()
+
+			Convey("Then every transfer succeeds and both balances are kept", func() {
+				for i := 1; i <= 2*requestsCount; i++ {
+					So(<-responses, ShouldEqual, 201)
+				}
+
+				_, body := getRequest(t, "/balance?playerId=P1")
+				So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+
+				_, body = getRequest(t, "/balance?playerId=P2")
+				So(parseJSONPlayerBody(t, body).Balance, ShouldEqual, 1000)
+			})
+		})
+	})
+}
+
+func TestConcurrentFund(t *testing.T) {
+	Convey("Test fund endpoint concurrently", t, func() {
+		resetDB(t)
+
+		Convey("Given I call fund endpoint 10 times in different goroutines", func() {
+			const requestsCount = 10
+			responses := make(chan int, requestsCount)
+
+			var wg sync.WaitGroup
+			for i := 1; i <= requestsCount; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					res, _ := getRequest(t, "/fund?playerId=P1&points=100")
+					responses <- res.StatusCode
+				}()
+			}
+			wg.Wait()
+
+			Convey("When I count every successful response", func() {
+				successResponses := 0
+				for i := 1; i <= requestsCount; i++ {
+					if 200 == <-responses {
+						successResponses++
+					}
+				}
+
+				Convey("Then I get 10 responses with 200 status code", func() {
+					So(successResponses, ShouldEqual, requestsCount)
+				})
+
+				Convey("And when I check the player's balance", func() {
+					_, body := getRequest(t, "/balance?playerId=P1")
+					balanceData := parseJSONPlayerBody(t, body)
+
+					Convey("Then his balance should equal 1000", func() {
+						So(balanceData.Balance, ShouldEqual, 1000)
+					})
+				})
+			})
+		})
+	})
+}
+
+func TestConcurrentTake(t *testing.T) {
+	Convey("Test take endpoint concurrently", t, func() {
+		resetDB(t)
+
+		Convey("Given I set player P1 with 100 points", func() {
+			getRequest(t, "/fund?playerId=P1&points=100")
 
 			Convey("When I call take endpoint 5 times in different goroutines", func() {
 				const requestsCount = 5
@@ -620,6 +3114,93 @@ func TestConcurrentTournamentAnnounce(t *testing.T) {
 	})
 }
 
+func TestConcurrentTournamentIDs(t *testing.T) {
+	Convey("Test tournament ids allocated concurrently with the passed ones", t, func() {
+		resetDB(t)
+
+		Convey("Given the tournament with the allocated ID", func() {
+			_, body := postRequest(t, "/v2/tournaments", map[string]int{"deposit": 100})
+			lastID := parseJSONTournamentBody(t, body).TournamentID
+
+			Convey("When I create 5 tournaments with the next IDs and 5 tournaments without ID at once", func() {
+				const requestsCount = 5
+				type created struct {
+					explicit bool
+					status   int
+					body     string
+				}
+				responses := make(chan created, 2*requestsCount)
+
+				var wg sync.WaitGroup
+				for i := 1; i <= requestsCount; i++ {
+					for _, tournamentID := range []int{lastID + i, 0} {
+						wg.Add(1)
+						go func(tournamentID int) {
+							defer wg.Done()
+							res, body := postRequest(t, "/v2/tournaments", map[string]int{"tournamentId": tournamentID, "deposit": 100})
+							responses <- created{explicit: tournamentID != 0, status: res.StatusCode, body: body}
+						}(tournamentID)
+					}
+				}
+				wg.Wait()
+				close(responses)
+
+				Convey("Then every tournament without ID is created, the passed ID is either free or already taken, and no ID is given twice", func() {
+					ids := make(map[int]bool)
+					for response := range responses {
+						if !response.explicit {
+							So(response.status, ShouldEqual, 201)
+						} else if response.status != 201 {
+							So(parseJSONErrorBody(t, response.body).Code, ShouldEqual, models.CodeTournamentExists)
+							continue
+						}
+
+						tournamentID := parseJSONTournamentBody(t, response.body).TournamentID
+						So(ids[tournamentID], ShouldBeFalse)
+						ids[tournamentID] = true
+					}
+				})
+			})
+
+			Convey("When I create 10 tournaments with the next IDs at once and then the one without ID", func() {
+				var wg sync.WaitGroup
+				for i := 1; i <= 10; i++ {
+					wg.Add(1)
+					go func(tournamentID int) {
+						defer wg.Done()
+						postRequest(t, "/v2/tournaments", map[string]int{"tournamentId": tournamentID, "deposit": 100})
+					}(lastID + i)
+				}
+				wg.Wait()
+
+				res, body := postRequest(t, "/v2/tournaments", map[string]int{"deposit": 100})
+
+				Convey("Then it gets the ID after the greatest passed one, as the sequence never moves backwards", func() {
+					So(res.StatusCode, ShouldEqual, 201)
+					So(parseJSONTournamentBody(t, body).TournamentID, ShouldEqual, lastID+11)
+				})
+			})
+
+			Convey("When I create the tournament without ID twice with the same request ID", func() {
+				res1, body1 := postRequest(t, "/v2/tournaments?requestId=T1", map[string]int{"deposit": 100})
+				res2, body2 := postRequest(t, "/v2/tournaments?requestId=T1", map[string]int{"deposit": 100})
+
+				Convey("Then the second response is the replay with the same tournament ID", func() {
+					So(res1.StatusCode, ShouldEqual, 201)
+					So(res2.StatusCode, ShouldEqual, 201)
+					So(res2.Header.Get("Idempotent-Replayed"), ShouldEqual, "true")
+					So(parseJSONTournamentBody(t, body2).TournamentID, ShouldEqual, parseJSONTournamentBody(t, body1).TournamentID)
+				})
+
+				Convey("And only one tournament is created", func() {
+					_, body := postRequest(t, "/v2/tournaments", map[string]int{"deposit": 100})
+					So(parseJSONTournamentBody(t, body).TournamentID, ShouldEqual, parseJSONTournamentBody(t, body1).TournamentID+1)
+				})
+			})
+		})
+	})
+}
+
 func TestConcurrentTournamentJoin(t *testing.T) {
 	Convey("Test joinTournament endpoint concurrently", t, func() {
 		resetDB(t)
@@ -693,6 +3274,7 @@ func TestConcurrentTournamentResult(t *testing.T) {
 						winner1 := winner{PlayerID: "P1", Prize: 1000}
 						winner2 := winner{PlayerID: "P2", Prize: 500}
 						result := tournament{TournamentID: "1", Winners: []winner{winner1, winner2}}
+						postRequest(t, "/tournaments/1/start", nil)
 
 						const requestsCount = 5
 						responses := make(chan int, requestsCount)
@@ -0,0 +1,14 @@
+BEGIN;
+
+-- CREATE TABLE "signed_requests" ------------------------------
+-- signatures of the accepted requests, so none of them could be replayed
+CREATE TABLE "public"."signed_requests" (
+	"signature" Character Varying( 64 ) NOT NULL,
+	"partner_id" Character Varying( 256 ) NOT NULL,
+	"created_at" Timestamp With Time Zone DEFAULT now() NOT NULL,
+ PRIMARY KEY ( "signature" ) );
+
+CREATE INDEX "index_signed_requests_created_at" ON "public"."signed_requests" USING btree( "created_at" );
+-- -------------------------------------------------------------;
+
+COMMIT;
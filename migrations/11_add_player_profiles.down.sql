@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE players DROP COLUMN IF EXISTS display_name;
+ALTER TABLE players DROP COLUMN IF EXISTS currency;
+ALTER TABLE players DROP COLUMN IF EXISTS region;
+ALTER TABLE players DROP COLUMN IF EXISTS status;
+ALTER TABLE players DROP COLUMN IF EXISTS created_at;
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+-- ALTER TABLE "players" ---------------------------------------
+ALTER TABLE "public"."players"
+	ADD COLUMN "display_name" Character Varying( 256 ) DEFAULT '' NOT NULL,
+	ADD COLUMN "currency" Character Varying( 3 ) DEFAULT '' NOT NULL,
+	ADD COLUMN "region" Character Varying( 64 ) DEFAULT '' NOT NULL,
+	ADD COLUMN "status" Character Varying( 32 ) DEFAULT 'active' NOT NULL
+	CHECK (status IN ('active', 'suspended', 'closed')),
+	ADD COLUMN "created_at" Timestamp With Time Zone DEFAULT now() NOT NULL;
+-- -------------------------------------------------------------;
+
+COMMIT;
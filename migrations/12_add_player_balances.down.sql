@@ -0,0 +1,11 @@
+BEGIN;
+
+ALTER TABLE players ADD COLUMN points Integer DEFAULT 0 NOT NULL CHECK (points >= 0);
+UPDATE players AS p SET points = b.amount FROM player_balances AS b
+WHERE b.player_id = p.player_id AND b.currency = 'points';
+
+ALTER TABLE tournaments DROP COLUMN IF EXISTS currency;
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS currency;
+DROP TABLE IF EXISTS player_balances;
+
+COMMIT;
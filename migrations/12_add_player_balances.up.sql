@@ -0,0 +1,28 @@
+BEGIN;
+
+-- CREATE TABLE "player_balances" ------------------------------
+-- every player has a separate balance in every currency (points, bonus, USD, ...), they never mix
+CREATE TABLE "public"."player_balances" (
+	"player_id" Character Varying( 256 ) NOT NULL references players(player_id) ON DELETE CASCADE,
+	"currency" Character Varying( 16 ) NOT NULL,
+	"amount" Integer NOT NULL CHECK (amount >= 0),
+ PRIMARY KEY ( "player_id", "currency" ) );
+-- -------------------------------------------------------------;
+
+INSERT INTO player_balances (player_id, currency, amount)
+SELECT player_id, 'points', points FROM players;
+
+ALTER TABLE "public"."players" DROP COLUMN "points";
+
+-- ALTER TABLE "ledger_entries" --------------------------------
+ALTER TABLE "public"."ledger_entries"
+	ADD COLUMN "currency" Character Varying( 16 ) DEFAULT 'points' NOT NULL;
+-- -------------------------------------------------------------;
+
+-- ALTER TABLE "tournaments" -----------------------------------
+-- the currency of the deposit and the prizes
+ALTER TABLE "public"."tournaments"
+	ADD COLUMN "currency" Character Varying( 16 ) DEFAULT 'points' NOT NULL;
+-- -------------------------------------------------------------;
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS bucket;
+ALTER TABLE player_balances DROP COLUMN IF EXISTS bonus;
+ALTER TABLE player_balances DROP COLUMN IF EXISTS restricted;
+ALTER TABLE player_balances DROP COLUMN IF EXISTS wagering;
+ALTER TABLE player_balances ALTER COLUMN amount DROP DEFAULT;
+
+COMMIT;
@@ -0,0 +1,19 @@
+BEGIN;
+
+-- ALTER TABLE "player_balances" -------------------------------
+-- amount is withdrawable, bonus is the promotional credit and restricted holds the prizes won with it
+-- until the wagering requirement is met
+ALTER TABLE "public"."player_balances"
+	ALTER COLUMN "amount" SET DEFAULT 0,
+	ADD COLUMN "bonus" Integer DEFAULT 0 NOT NULL CHECK (bonus >= 0),
+	ADD COLUMN "restricted" Integer DEFAULT 0 NOT NULL CHECK (restricted >= 0),
+	ADD COLUMN "wagering" Integer DEFAULT 0 NOT NULL CHECK (wagering >= 0);
+-- -------------------------------------------------------------;
+
+-- ALTER TABLE "ledger_entries" --------------------------------
+ALTER TABLE "public"."ledger_entries"
+	ADD COLUMN "bucket" Character Varying( 16 ) DEFAULT 'cash' NOT NULL
+	CHECK (bucket IN ('cash', 'bonus', 'restricted'));
+-- -------------------------------------------------------------;
+
+COMMIT;
@@ -0,0 +1,21 @@
+BEGIN;
+
+-- CREATE TABLE "balance_holds" --------------------------------
+-- the part of the withdrawable balance reserved for the pending operation,
+-- the active hold stops counting once it is expired
+CREATE TABLE "public"."balance_holds" (
+	"id" Serial NOT NULL,
+	"player_id" Character Varying( 256 ) NOT NULL references players(player_id) ON DELETE CASCADE,
+	"currency" Character Varying( 16 ) NOT NULL,
+	"amount" Integer NOT NULL CHECK (amount > 0),
+	"reason" Character Varying( 256 ) DEFAULT '' NOT NULL,
+	"status" Character Varying( 32 ) DEFAULT 'active' NOT NULL CHECK (status IN ('active', 'captured', 'released')),
+	"expires_at" Timestamp With Time Zone NOT NULL,
+	"created_at" Timestamp With Time Zone DEFAULT now() NOT NULL,
+	"resolved_at" Timestamp With Time Zone,
+ PRIMARY KEY ( "id" ) );
+
+CREATE INDEX "index_balance_holds_player_id" ON "public"."balance_holds" USING btree( "player_id", "currency" ) WHERE status = 'active';
+-- -------------------------------------------------------------;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS transfer_id;
+DROP TABLE IF EXISTS transfers;
+
+COMMIT;
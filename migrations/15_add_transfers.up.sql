@@ -0,0 +1,21 @@
+BEGIN;
+
+-- CREATE TABLE "transfers" ------------------------------------
+CREATE TABLE "public"."transfers" (
+	"id" Serial NOT NULL,
+	"from_player_id" Character Varying( 256 ) NOT NULL references players(player_id) ON DELETE CASCADE,
+	"to_player_id" Character Varying( 256 ) NOT NULL references players(player_id) ON DELETE CASCADE,
+	"currency" Character Varying( 16 ) NOT NULL,
+	"amount" Integer NOT NULL CHECK (amount > 0),
+	"reference" Character Varying( 256 ) DEFAULT '' NOT NULL,
+	"created_at" Timestamp With Time Zone DEFAULT now() NOT NULL,
+ PRIMARY KEY ( "id" ),
+ CHECK (from_player_id <> to_player_id) );
+-- -------------------------------------------------------------;
+
+-- ALTER TABLE "ledger_entries" --------------------------------
+ALTER TABLE "public"."ledger_entries"
+	ADD COLUMN "transfer_id" Integer references transfers(id) ON DELETE CASCADE;
+-- -------------------------------------------------------------;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS tournament_payouts;
+DROP TABLE IF EXISTS tournament_results;
+
+COMMIT;
@@ -0,0 +1,44 @@
+BEGIN;
+
+-- CREATE TABLE "tournament_results" ---------------------------
+CREATE TABLE "public"."tournament_results" (
+	"id" Serial NOT NULL,
+	"tournament_id" Integer NOT NULL references tournaments(id) ON DELETE CASCADE,
+	"player_id" Character Varying( 256 ) NOT NULL references players(player_id) ON DELETE CASCADE,
+	"position" Integer NOT NULL,
+	"prize" Integer NOT NULL CHECK (prize >= 0),
+	"created_at" Timestamp With Time Zone DEFAULT now() NOT NULL,
+ PRIMARY KEY ( "id" ),
+ UNIQUE ( "tournament_id", "player_id" ) );
+-- -------------------------------------------------------------;
+
+-- CREATE TABLE "tournament_payouts" ---------------------------
+CREATE TABLE "public"."tournament_payouts" (
+	"id" Serial NOT NULL,
+	"result_id" Integer NOT NULL references tournament_results(id) ON DELETE CASCADE,
+	"player_id" Character Varying( 256 ) NOT NULL references players(player_id) ON DELETE CASCADE,
+	"currency" Character Varying( 16 ) NOT NULL,
+	"amount" Integer NOT NULL CHECK (amount >= 0),
+	"restricted" Integer DEFAULT 0 NOT NULL CHECK (restricted >= 0 AND restricted <= amount),
+ PRIMARY KEY ( "id" ) );
+
+CREATE INDEX "index_tournament_payouts_result_id" ON "public"."tournament_payouts" USING btree( "result_id" );
+-- -------------------------------------------------------------;
+
+-- the results of already finished tournaments are restored from the prize ledger entries
+INSERT INTO tournament_results (tournament_id, player_id, position, prize, created_at)
+	SELECT tournament_id, attendee_id,
+		ROW_NUMBER() OVER (PARTITION BY tournament_id ORDER BY SUM(amount) DESC, attendee_id),
+		SUM(amount), MIN(created_at)
+	FROM ledger_entries WHERE entry_type = 'prize'
+	GROUP BY tournament_id, attendee_id;
+
+INSERT INTO tournament_payouts (result_id, player_id, currency, amount, restricted)
+	SELECT r.id, le.player_id, le.currency, SUM(le.amount),
+		SUM(CASE WHEN le.bucket = 'restricted' THEN le.amount ELSE 0 END)
+	FROM ledger_entries AS le
+	JOIN tournament_results AS r ON r.tournament_id = le.tournament_id AND r.player_id = le.attendee_id
+	WHERE le.entry_type = 'prize'
+	GROUP BY r.id, le.player_id, le.currency;
+
+COMMIT;
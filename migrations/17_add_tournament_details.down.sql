@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE tournaments
+	DROP COLUMN IF EXISTS name,
+	DROP COLUMN IF EXISTS game_type,
+	DROP COLUMN IF EXISTS starts_at,
+	DROP COLUMN IF EXISTS max_attendees,
+	DROP COLUMN IF EXISTS min_attendees;
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+-- ALTER TABLE "tournaments" -----------------------------------
+ALTER TABLE "public"."tournaments"
+	ADD COLUMN "name" Character Varying( 256 ) DEFAULT '' NOT NULL,
+	ADD COLUMN "game_type" Character Varying( 64 ) DEFAULT '' NOT NULL,
+	ADD COLUMN "starts_at" Timestamp With Time Zone,
+
+	-- zero max attendees means the tournament is not limited
+	ADD COLUMN "max_attendees" Integer DEFAULT 0 NOT NULL CHECK (max_attendees >= 0),
+	ADD COLUMN "min_attendees" Integer DEFAULT 0 NOT NULL CHECK (min_attendees >= 0),
+	ADD CHECK (max_attendees = 0 OR min_attendees <= max_attendees);
+-- -------------------------------------------------------------;
+
+-- the ids were given by the clients so far, the generated ones should go after them
+SELECT setval(pg_get_serial_sequence('tournaments', 'id'), GREATEST(MAX(id), 1), MAX(id) IS NOT NULL) FROM tournaments;
+
+COMMIT;
@@ -0,0 +1,19 @@
+BEGIN;
+
+-- CREATE TABLE "tournament_waitlist" --------------------------
+CREATE TABLE "public"."tournament_waitlist" (
+	"id" Serial NOT NULL,
+	"tournament_id" Integer NOT NULL references tournaments(id) ON DELETE CASCADE,
+	"player_id" Character Varying( 256 ) NOT NULL references players(player_id) ON DELETE CASCADE,
+	"backers" Character Varying( 256 )[],
+
+	-- the stakes of the backers as they were passed, the deposit is split by them on promotion
+	"backer_shares" Integer[],
+	"percents" Boolean DEFAULT false NOT NULL,
+
+	"created_at" Timestamp With Time Zone DEFAULT now() NOT NULL,
+ PRIMARY KEY ( "id" ),
+ UNIQUE ( "tournament_id", "player_id" ) );
+-- -------------------------------------------------------------;
+
+COMMIT;
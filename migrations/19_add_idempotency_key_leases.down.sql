@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS index_idempotency_keys_created_at;
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS locked_until;
+
+COMMIT;
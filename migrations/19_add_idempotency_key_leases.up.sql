@@ -0,0 +1,11 @@
+BEGIN;
+
+-- ALTER TABLE "idempotency_keys" ------------------------------
+ALTER TABLE "public"."idempotency_keys"
+	-- the request in progress holds the key until then, the stale key is taken over by the retry after it
+	ADD COLUMN "locked_until" Timestamp With Time Zone DEFAULT now() NOT NULL;
+
+CREATE INDEX "index_idempotency_keys_created_at" ON "public"."idempotency_keys" USING btree( "created_at" );
+-- -------------------------------------------------------------;
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+DELETE FROM idempotency_keys;
+
+ALTER TABLE idempotency_keys
+	DROP CONSTRAINT IF EXISTS idempotency_keys_pkey,
+	DROP COLUMN IF EXISTS api_key_id,
+	ADD PRIMARY KEY ( key );
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+-- the keys were shared by every client so far, they are forgotten rather than given to one of them
+DELETE FROM idempotency_keys;
+
+-- ALTER TABLE "idempotency_keys" ------------------------------
+ALTER TABLE "public"."idempotency_keys"
+	ADD COLUMN "api_key_id" Integer NOT NULL references api_keys(id) ON DELETE CASCADE,
+	DROP CONSTRAINT "idempotency_keys_pkey",
+	ADD PRIMARY KEY ( "api_key_id", "key" );
+-- -------------------------------------------------------------;
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE idempotency_keys ADD COLUMN locked_until Timestamp With Time Zone DEFAULT now() NOT NULL;
+
+COMMIT;
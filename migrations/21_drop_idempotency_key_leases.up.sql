@@ -0,0 +1,10 @@
+BEGIN;
+
+-- the keys are stored along with the response now, the ones left without it are never finished
+DELETE FROM idempotency_keys WHERE status_code IS NULL;
+
+-- ALTER TABLE "idempotency_keys" ------------------------------
+ALTER TABLE "public"."idempotency_keys" DROP COLUMN "locked_until";
+-- -------------------------------------------------------------;
+
+COMMIT;
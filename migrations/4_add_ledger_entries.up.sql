@@ -0,0 +1,24 @@
+BEGIN;
+
+-- CREATE TABLE "ledger_entries" -------------------------------
+CREATE TABLE "public"."ledger_entries" (
+	"id" Serial NOT NULL,
+	"player_id" Character Varying( 256 ) NOT NULL references players(player_id) ON DELETE CASCADE,
+	"tournament_id" Integer references tournaments(id),
+
+	-- the player who attended the tournament, so the backer's entries point to the player they backed
+	"attendee_id" Character Varying( 256 ),
+
+	"entry_type" Character Varying( 32 ) NOT NULL,
+	"amount" Integer NOT NULL,
+	"created_at" Timestamp With Time Zone DEFAULT now() NOT NULL,
+ PRIMARY KEY ( "id" ) );
+
+CREATE INDEX "index_ledger_entries_player_id" ON "public"."ledger_entries" USING btree( "player_id", "id" );
+-- -------------------------------------------------------------;
+
+-- every existing balance becomes an opening entry, so the ledger sums up to the current points
+INSERT INTO ledger_entries (player_id, entry_type, amount)
+SELECT player_id, 'opening', points FROM players;
+
+COMMIT;
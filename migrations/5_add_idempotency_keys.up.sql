@@ -0,0 +1,16 @@
+BEGIN;
+
+-- CREATE TABLE "idempotency_keys" -----------------------------
+CREATE TABLE "public"."idempotency_keys" (
+	"key" Character Varying( 256 ) NOT NULL,
+	"request_hash" Character Varying( 64 ) NOT NULL,
+
+	-- both stay empty while the first request with the key is still in progress
+	"status_code" Integer,
+	"response" Bytea,
+
+	"created_at" Timestamp With Time Zone DEFAULT now() NOT NULL,
+ PRIMARY KEY ( "key" ) );
+-- -------------------------------------------------------------;
+
+COMMIT;
@@ -0,0 +1 @@
+ALTER TABLE tournament_attendees DROP COLUMN IF EXISTS stake, DROP COLUMN IF EXISTS backer_stakes;
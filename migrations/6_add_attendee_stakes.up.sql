@@ -0,0 +1,28 @@
+BEGIN;
+
+-- ALTER TABLE "tournament_attendees" --------------------------
+ALTER TABLE "public"."tournament_attendees"
+	ADD COLUMN "stake" Integer DEFAULT 0 NOT NULL CHECK (stake >= 0),
+	ADD COLUMN "backer_stakes" Integer[] DEFAULT array[]::Integer[] NOT NULL;
+-- -------------------------------------------------------------;
+
+-- the stakes of existing attendees are the deposits they were charged,
+-- attendees joined before the ledger existed were charged equal shares
+UPDATE tournament_attendees AS ta SET
+	stake = COALESCE(
+		(SELECT -SUM(le.amount) FROM ledger_entries AS le
+		 WHERE le.entry_type = 'deposit' AND le.tournament_id = ta.tournament_id
+		 AND le.attendee_id = ta.player_id AND le.player_id = ta.player_id),
+		t.deposit / (cardinality(ta.backers) + 1)),
+	backer_stakes = ARRAY(
+		SELECT COALESCE(
+			(SELECT -SUM(le.amount) FROM ledger_entries AS le
+			 WHERE le.entry_type = 'deposit' AND le.tournament_id = ta.tournament_id
+			 AND le.attendee_id = ta.player_id AND le.player_id = b.backer_id),
+			t.deposit / (cardinality(ta.backers) + 1))
+		FROM unnest(ta.backers) WITH ORDINALITY AS b(backer_id, position)
+		ORDER BY b.position)
+FROM tournaments AS t
+WHERE t.id = ta.tournament_id;
+
+COMMIT;
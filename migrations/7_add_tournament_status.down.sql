@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE tournaments ADD COLUMN finished Boolean DEFAULT FALSE NOT NULL;
+UPDATE tournaments SET finished = true WHERE status = 'finished';
+ALTER TABLE tournaments DROP COLUMN IF EXISTS status;
+
+COMMIT;
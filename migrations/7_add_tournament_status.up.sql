@@ -0,0 +1,13 @@
+BEGIN;
+
+-- ALTER TABLE "tournaments" -----------------------------------
+ALTER TABLE "public"."tournaments"
+	ADD COLUMN "status" Character Varying( 32 ) DEFAULT 'announced' NOT NULL
+	CHECK (status IN ('announced', 'registration_closed', 'running', 'finished', 'cancelled'));
+-- -------------------------------------------------------------;
+
+UPDATE tournaments SET status = 'finished' WHERE finished;
+
+ALTER TABLE "public"."tournaments" DROP COLUMN "finished";
+
+COMMIT;
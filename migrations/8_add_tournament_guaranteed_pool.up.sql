@@ -0,0 +1,8 @@
+BEGIN;
+
+-- ALTER TABLE "tournaments" -----------------------------------
+ALTER TABLE "public"."tournaments"
+	ADD COLUMN "guaranteed_pool" Integer DEFAULT 0 NOT NULL CHECK (guaranteed_pool >= 0);
+-- -------------------------------------------------------------;
+
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+
+-- CREATE TABLE "api_keys" -------------------------------------
+CREATE TABLE "public"."api_keys" (
+	"id" Serial NOT NULL,
+	"name" Character Varying( 256 ) NOT NULL,
+
+	-- only sha256 of the key is stored, the key itself is shown once on creation
+	"key_hash" Character Varying( 64 ) NOT NULL UNIQUE,
+
+	"role" Character Varying( 32 ) NOT NULL CHECK (role IN ('admin', 'operator', 'cashier', 'reader')),
+	"created_at" Timestamp With Time Zone DEFAULT now() NOT NULL,
+	"revoked_at" Timestamp With Time Zone,
+ PRIMARY KEY ( "id" ) );
+-- -------------------------------------------------------------;
+
+COMMIT;
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"bidder/util"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+// API key roles. Admin is allowed to do everything, the rest only what their name says.
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleCashier  = "cashier"
+	RoleReader   = "reader"
+)
+
+var roles = map[string]bool{
+	RoleAdmin:    true,
+	RoleOperator: true,
+	RoleCashier:  true,
+	RoleReader:   true,
+}
+
+// APIKey struct holds the API key of the client and the role it grants.
+// Key is filled only on creation, as only the hash of it is stored.
+type APIKey struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Role      string     `json:"role"`
+	Key       string     `json:"key,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// Validate method checks the params before execute actual request
+func (k *APIKey) Validate() error {
+	if len(k.Name) == 0 {
+		return validationError("Name should not be empty!")
+	}
+
+	if !roles[k.Role] {
+		return validationError("Role should be one of admin, operator, cashier or reader!")
+	}
+
+	return nil
+}
+
+// Create method generates the new key and stores its hash in the DataBase
+func (k *APIKey) Create() error {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	k.Key = hex.EncodeToString(secret)
+
+	tx, err := util.DBConnect.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = k.insert(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FindAPIKey function returns the active API key by the key itself
+func FindAPIKey(key string) (*APIKey, error) {
+	stmt, err := util.DBConnect.Prepare(`SELECT id, name, role, created_at FROM api_keys
+                                      WHERE key_hash = $1 AND revoked_at IS NULL;`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	apiKey := new(APIKey)
+	err = stmt.QueryRow(hashAPIKey(key)).Scan(&apiKey.ID, &apiKey.Name, &apiKey.Role, &apiKey.CreatedAt)
+	if err != nil {
+		return nil, notFound(err, CodeUnauthorized, "Invalid API key")
+	}
+
+	return apiKey, nil
+}
+
+// ListAPIKeys function returns every API key, revoked ones included
+func ListAPIKeys() ([]APIKey, error) {
+	rows, err := util.DBConnect.Query(`SELECT id, name, role, created_at, revoked_at FROM api_keys ORDER BY id;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var apiKeys []APIKey
+	for rows.Next() {
+		var apiKey APIKey
+		if err = rows.Scan(&apiKey.ID, &apiKey.Name, &apiKey.Role, &apiKey.CreatedAt, &apiKey.RevokedAt); err != nil {
+			return nil, err
+		}
+
+		apiKeys = append(apiKeys, apiKey)
+	}
+
+	return apiKeys, rows.Err()
+}
+
+// RevokeAPIKey function disables the API key forever
+func RevokeAPIKey(id int) error {
+	var revokedID int
+	err := util.DBConnect.QueryRow(`UPDATE api_keys SET revoked_at = now()
+                                  WHERE id = $1 AND revoked_at IS NULL RETURNING id;`, id).Scan(&revokedID)
+
+	return notFound(err, CodeAPIKeyNotFound, "No such active API key")
+}
+
+// Allows method tells whether the key grants one of the roles
+func (k *APIKey) Allows(allowedRoles ...string) bool {
+	if k.Role == RoleAdmin {
+		return true
+	}
+
+	for _, role := range allowedRoles {
+		if k.Role == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (k *APIKey) insert(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`INSERT INTO api_keys (name, key_hash, role) VALUES ($1, $2, $3) RETURNING id, created_at;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	return stmt.QueryRow(k.Name, hashAPIKey(k.Key), k.Role).Scan(&k.ID, &k.CreatedAt)
+}
+
+func hashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"database/sql"
+	"regexp"
+	"sort"
+)
+
+// DefaultCurrency is the currency of the points moved without any currency given
+const DefaultCurrency = "points"
+
+// currencyFormat allows both the assets like points or bonus and the money like USD
+var currencyFormat = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,15}$`)
+
+// heldAmount is the part of the withdrawable balance of the player p in the currency $2
+// reserved by the holds, which are neither resolved nor expired yet
+const heldAmount = `COALESCE((SELECT SUM(h.amount) FROM balance_holds AS h
+                   WHERE h.player_id = p.player_id AND h.currency = $2
+                   AND h.status = 'active' AND h.expires_at > now()), 0)`
+
+// validateCurrency function sets the default currency if it is empty and checks it otherwise
+func validateCurrency(currency *string) error {
+	if len(*currency) == 0 {
+		*currency = DefaultCurrency
+	}
+
+	if !currencyFormat.MatchString(*currency) {
+		return validationError("Currency should be up to 16 letters, digits or underscores!")
+	}
+
+	return nil
+}
+
+// lockBalance function locks the player and returns his status and available balance in the currency,
+// which is the withdrawable balance without the held part
+func lockBalance(tx *sql.Tx, playerID, currency string) (string, int, error) {
+	stmt, err := tx.Prepare(`SELECT p.status, COALESCE(b.amount, 0) - ` + heldAmount + ` FROM players AS p
+                           LEFT JOIN player_balances AS b ON b.player_id = p.player_id AND b.currency = $2
+                           WHERE p.player_id = $1 FOR UPDATE OF p;`)
+	if err != nil {
+		return "", 0, err
+	}
+	defer stmt.Close()
+
+	var status string
+	var amount int
+	if err := stmt.QueryRow(playerID, currency).Scan(&status, &amount); err != nil {
+		return "", 0, notFound(err, CodePlayerNotFound, "No such player")
+	}
+
+	return status, amount, nil
+}
+
+// lockPlayers function locks the players in the order of their ids,
+// so the transactions locking several players never deadlock
+func lockPlayers(tx *sql.Tx, playerIDs []string) error {
+	ids := append([]string{}, playerIDs...)
+	sort.Strings(ids)
+
+	stmt, err := tx.Prepare(`SELECT player_id FROM players WHERE player_id = ANY($1) ORDER BY player_id FOR UPDATE;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(preparePostgresArray(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// the rows are read only to take the locks
+	for rows.Next() {
+	}
+
+	return rows.Err()
+}
+
+// findBalances method fills every balance of the player by currency
+func (p *Player) findBalances(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`SELECT currency, amount, bonus, restricted, wagering FROM player_balances WHERE player_id = $1;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(p.PlayerID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	p.Balances = make(map[string]int)
+	p.Bonus = make(map[string]int)
+	p.Restricted = make(map[string]int)
+	p.Wagering = make(map[string]int)
+	for rows.Next() {
+		var currency string
+		var amount, bonus, restricted, wagering int
+		if err = rows.Scan(&currency, &amount, &bonus, &restricted, &wagering); err != nil {
+			return err
+		}
+
+		p.Balances[currency] = amount
+		if bonus != 0 {
+			p.Bonus[currency] = bonus
+		}
+		if restricted != 0 {
+			p.Restricted[currency] = restricted
+		}
+		if wagering != 0 {
+			p.Wagering[currency] = wagering
+		}
+	}
+	p.Balance = p.Balances[DefaultCurrency]
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return p.findHeld(tx)
+}
+
+// findHeld method fills the held and the available balances of the player by currency
+func (p *Player) findHeld(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`SELECT currency, SUM(amount) FROM balance_holds
+                           WHERE player_id = $1 AND status = 'active' AND expires_at > now() GROUP BY currency;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(p.PlayerID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	p.Held = make(map[string]int)
+	for rows.Next() {
+		var currency string
+		var amount int
+		if err = rows.Scan(&currency, &amount); err != nil {
+			return err
+		}
+
+		p.Held[currency] = amount
+	}
+
+	p.Available = make(map[string]int)
+	for currency, amount := range p.Balances {
+		p.Available[currency] = amount - p.Held[currency]
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,230 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// Batch operations and modes. Atomic batch is applied all-or-nothing,
+// best-effort one applies every valid operation and reports the rest as failed.
+const (
+	OperationFund = "fund"
+	OperationTake = "take"
+
+	BatchAtomic     = "atomic"
+	BatchBestEffort = "bestEffort"
+)
+
+const maxBatchOperations = 10000
+
+// BatchOperation struct holds a single fund or take operation of the batch
+type BatchOperation struct {
+	Operation string `json:"operation"`
+	PlayerID  string `json:"playerId"`
+	Points    int    `json:"points"`
+	Currency  string `json:"currency"`
+	Bucket    string `json:"bucket"`
+}
+
+// BatchResult struct holds the result of a single operation of the batch
+type BatchResult struct {
+	Index     int    `json:"index"`
+	PlayerID  string `json:"playerId"`
+	Operation string `json:"operation"`
+	Status    string `json:"status"`
+	Error     *Error `json:"error,omitempty"`
+}
+
+// PlayersBatch struct holds the fund and take operations applied in one transaction
+type PlayersBatch struct {
+	Mode       string           `json:"mode"`
+	Operations []BatchOperation `json:"-"`
+	Results    []BatchResult    `json:"results"`
+	Succeeded  int              `json:"succeeded"`
+	Failed     int              `json:"failed"`
+}
+
+// Validate method checks the params before execute actual request.
+// Invalid operations fail the whole atomic batch, but only themselves in the best-effort one.
+func (b *PlayersBatch) Validate() error {
+	if len(b.Mode) == 0 {
+		b.Mode = BatchAtomic
+	}
+
+	if b.Mode != BatchAtomic && b.Mode != BatchBestEffort {
+		return validationError("Mode should be either atomic or bestEffort!")
+	}
+
+	if len(b.Operations) == 0 || len(b.Operations) > maxBatchOperations {
+		return validationError("Operations should have from 1 to %d items!", maxBatchOperations)
+	}
+
+	if b.Mode == BatchBestEffort {
+		return nil
+	}
+
+	var invalidFields fieldErrors
+	for i := range b.Operations {
+		if err := b.Operations[i].validate(); err != nil {
+			invalidFields.add(fmt.Sprintf("operations[%d]", i), "%s", err.(*Error).Message)
+		}
+	}
+
+	return invalidFields.toError(CodeValidationFailed, "Operations are invalid")
+}
+
+// Apply method applies every operation of the batch in one transaction. Every player is locked
+// in the order of his id before any operation and the operations are applied in the same order,
+// so concurrent batches never deadlock. Operations of the same player keep the order they were passed in.
+func (b *PlayersBatch) Apply(key *IdempotencyKey) error {
+	tx, err := key.begin()
+	if err != nil {
+		return err
+	}
+
+	if err = b.lockPlayers(tx); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	order := make([]int, len(b.Operations))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return b.Operations[order[i]].PlayerID < b.Operations[order[j]].PlayerID
+	})
+
+	b.Results = make([]BatchResult, 0, len(b.Operations))
+	for _, i := range order {
+		if b.Mode == BatchAtomic {
+			err = b.applyAtomic(tx, i)
+		} else {
+			err = b.applyBestEffort(tx, i)
+		}
+
+		if err != nil {
+			key.rollback(tx)
+			return err
+		}
+	}
+
+	sort.Slice(b.Results, func(i, j int) bool {
+		return b.Results[i].Index < b.Results[j].Index
+	})
+
+	return key.commit(tx)
+}
+
+func (b *PlayersBatch) lockPlayers(tx *sql.Tx) error {
+	ids := make([]string, 0, len(b.Operations))
+	for _, operation := range b.Operations {
+		ids = append(ids, operation.PlayerID)
+	}
+
+	return lockPlayers(tx, ids)
+}
+
+// applyAtomic method applies the operation and turns its failure into the failure of the whole batch
+func (b *PlayersBatch) applyAtomic(tx *sql.Tx, i int) error {
+	err := b.Operations[i].apply(tx)
+	if domainError, ok := err.(*Error); ok {
+		return &Error{
+			Code:    domainError.Code,
+			Message: fmt.Sprintf("Operation %d failed: %s", i, domainError.Message),
+			Fields:  []FieldError{{Field: fmt.Sprintf("operations[%d]", i), Message: domainError.Message}},
+		}
+	}
+
+	if err == nil {
+		b.addResult(i, nil)
+	}
+
+	return err
+}
+
+// applyBestEffort method applies the operation within the savepoint,
+// so its failure is rolled back without the operations applied before
+func (b *PlayersBatch) applyBestEffort(tx *sql.Tx, i int) error {
+	if _, err := tx.Exec(`SAVEPOINT batch_operation;`); err != nil {
+		return err
+	}
+
+	err := b.Operations[i].validate()
+	if err == nil {
+		err = b.Operations[i].apply(tx)
+	}
+
+	if err == nil {
+		b.addResult(i, nil)
+		_, err = tx.Exec(`RELEASE SAVEPOINT batch_operation;`)
+		return err
+	}
+
+	domainError, ok := err.(*Error)
+	if !ok {
+		log.Printf("Batch operation %d failed due to error: %s", i, err)
+		domainError = &Error{Code: CodeInternal, Message: "Internal server error"}
+	}
+	b.addResult(i, domainError)
+
+	_, err = tx.Exec(`ROLLBACK TO SAVEPOINT batch_operation;`)
+	return err
+}
+
+func (b *PlayersBatch) addResult(i int, err *Error) {
+	result := BatchResult{Index: i, PlayerID: b.Operations[i].PlayerID, Operation: b.Operations[i].Operation, Status: "ok"}
+	if err != nil {
+		result.Status, result.Error = "failed", err
+		b.Failed++
+	} else {
+		b.Succeeded++
+	}
+
+	b.Results = append(b.Results, result)
+}
+
+func (o *BatchOperation) validate() error {
+	if o.Operation != OperationFund && o.Operation != OperationTake {
+		return validationError("Operation should be either fund or take!")
+	}
+
+	if o.Points <= 0 {
+		return validationError("Points should be positive number!")
+	}
+
+	player := o.player()
+	if err := player.Validate(); err != nil {
+		return err
+	}
+
+	if o.Operation == OperationTake && player.Bucket != BucketCash {
+		return validationError("Only withdrawable points could be taken!")
+	}
+
+	return nil
+}
+
+// apply method runs the same steps as Fund and Take do, within the batch transaction
+func (o *BatchOperation) apply(tx *sql.Tx) error {
+	player := o.player()
+	if err := player.Validate(); err != nil {
+		return err
+	}
+
+	if o.Operation == OperationFund {
+		return player.fundPlayer(tx)
+	}
+
+	if err := player.checkPoints(tx); err != nil {
+		return err
+	}
+
+	return player.substractPoints(tx)
+}
+
+func (o *BatchOperation) player() Player {
+	return Player{PlayerID: o.PlayerID, Points: o.Points, BalanceCurrency: o.Currency, Bucket: o.Bucket}
+}
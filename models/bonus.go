@@ -0,0 +1,171 @@
+package models
+
+import (
+	"bidder/util"
+	"database/sql"
+)
+
+// Balance buckets. Cash is withdrawable, bonus is the promotional credit spent on tournaments only
+// and restricted holds the prizes won with the promotional money until the wagering requirement is met.
+const (
+	BucketCash       = "cash"
+	BucketBonus      = "bonus"
+	BucketRestricted = "restricted"
+)
+
+// bucketColumns maps every bucket to the column of player_balances holding it
+var bucketColumns = map[string]string{
+	BucketCash:       "amount",
+	BucketBonus:      "bonus",
+	BucketRestricted: "restricted",
+}
+
+// paymentOrder function returns the buckets in the order the tournament deposit is paid with
+func paymentOrder() []string {
+	if util.BonusFirst() {
+		return []string{BucketBonus, BucketRestricted, BucketCash}
+	}
+
+	return []string{BucketCash, BucketRestricted, BucketBonus}
+}
+
+// payFromBuckets function splits the amount between the buckets of the balance in the payment order.
+// It returns false if all the buckets together are not enough to pay it.
+func payFromBuckets(balance map[string]int, amount int) (map[string]int, bool) {
+	parts := make(map[string]int)
+	for _, bucket := range paymentOrder() {
+		part := balance[bucket]
+		if part > amount {
+			part = amount
+		}
+
+		if part > 0 {
+			parts[bucket] = part
+			amount -= part
+		}
+	}
+
+	return parts, amount == 0
+}
+
+// restrictedPart function returns the part of the prize won with the promotional money,
+// in the same proportion as the stake was paid with it. The remainder of the division is restricted,
+// so the bonus is never cashed out by rounding.
+func restrictedPart(prize, cashPaid, promoPaid int) int {
+	if promoPaid <= 0 {
+		return 0
+	}
+
+	return (prize*promoPaid + cashPaid + promoPaid - 1) / (cashPaid + promoPaid)
+}
+
+// paidByBuckets function returns the deposit paid for the attendee and not refunded yet
+// by every player and bucket
+func paidByBuckets(tx *sql.Tx, tournamentID int, attendeeID string) (map[string]map[string]int, error) {
+	stmt, err := tx.Prepare(`SELECT player_id, bucket, -SUM(amount) FROM ledger_entries
+                           WHERE tournament_id = $1 AND attendee_id = $2 AND entry_type = ANY($3)
+                           GROUP BY player_id, bucket;`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(tournamentID, attendeeID, preparePostgresArray([]string{EntryDeposit, EntryRefund}))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paid := make(map[string]map[string]int)
+	for rows.Next() {
+		var playerID, bucket string
+		var amount int
+		if err = rows.Scan(&playerID, &bucket, &amount); err != nil {
+			return nil, err
+		}
+
+		if paid[playerID] == nil {
+			paid[playerID] = make(map[string]int)
+		}
+		paid[playerID][bucket] = amount
+	}
+
+	return paid, rows.Err()
+}
+
+// addWagering function raises the wagering requirement of the player in the currency
+func addWagering(tx *sql.Tx, playerID, currency string, amount int) error {
+	stmt, err := tx.Prepare(`UPDATE player_balances SET wagering = wagering + $3 WHERE player_id = $1 AND currency = $2;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(playerID, currency, amount)
+	return err
+}
+
+// wagerDeposits function counts the deposits of the finished tournament
+// towards the wagering requirement of every player who paid them
+func wagerDeposits(tx *sql.Tx, tournamentID int) error {
+	stmt, err := tx.Prepare(`UPDATE player_balances AS b SET wagering = GREATEST(b.wagering - d.paid, 0)
+                           FROM (SELECT player_id, currency, -SUM(amount) AS paid FROM ledger_entries
+                                 WHERE tournament_id = $1 AND entry_type = ANY($2)
+                                 GROUP BY player_id, currency HAVING SUM(amount) < 0) AS d
+                           WHERE b.player_id = d.player_id AND b.currency = d.currency AND b.wagering > 0;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(tournamentID, preparePostgresArray([]string{EntryDeposit, EntryRefund}))
+	return err
+}
+
+// releaseRestricted function moves the restricted prizes to the withdrawable balance
+// of every player of the tournament who has met the wagering requirement
+func releaseRestricted(tx *sql.Tx, tournamentID int) error {
+	stmt, err := tx.Prepare(`SELECT player_id, currency, restricted FROM player_balances
+                           WHERE wagering = 0 AND restricted > 0
+                           AND player_id IN (SELECT player_id FROM ledger_entries WHERE tournament_id = $1)
+                           ORDER BY player_id, currency FOR UPDATE;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(tournamentID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var releases []LedgerEntry
+	for rows.Next() {
+		release := LedgerEntry{TournamentID: tournamentID, Type: EntryRelease}
+		if err = rows.Scan(&release.PlayerID, &release.Currency, &release.Amount); err != nil {
+			return err
+		}
+
+		releases = append(releases, release)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, release := range releases {
+		entries := []LedgerEntry{release, release}
+		entries[0].Bucket, entries[0].Amount = BucketRestricted, -release.Amount
+		entries[1].Bucket = BucketCash
+
+		for i := range entries {
+			if err = entries[i].apply(tx); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
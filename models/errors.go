@@ -0,0 +1,87 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Error codes of the application. Clients rely on them, so they should never change.
+const (
+	CodeValidationFailed         = "VALIDATION_FAILED"
+	CodeInvalidWinners           = "INVALID_WINNERS"
+	CodePrizePoolExceeded        = "PRIZE_POOL_EXCEEDED"
+	CodePlayerNotFound           = "PLAYER_NOT_FOUND"
+	CodePlayerExists             = "PLAYER_EXISTS"
+	CodePlayerNotActive          = "PLAYER_NOT_ACTIVE"
+	CodePlayerHasFunds           = "PLAYER_HAS_FUNDS"
+	CodeTournamentNotFound       = "TOURNAMENT_NOT_FOUND"
+	CodeAttendeeNotFound         = "ATTENDEE_NOT_FOUND"
+	CodeInsufficientFunds        = "INSUFFICIENT_FUNDS"
+	CodeTournamentExists         = "TOURNAMENT_EXISTS"
+	CodeTournamentFinished       = "TOURNAMENT_FINISHED"
+	CodeTournamentCancelled      = "TOURNAMENT_CANCELLED"
+	CodeInvalidTournamentStatus  = "INVALID_TOURNAMENT_STATUS"
+	CodeAlreadyJoined            = "ALREADY_JOINED"
+	CodeTournamentFull           = "TOURNAMENT_FULL"
+	CodeHoldNotFound             = "HOLD_NOT_FOUND"
+	CodeHoldNotActive            = "HOLD_NOT_ACTIVE"
+	CodeIdempotencyKeyReused     = "IDEMPOTENCY_KEY_REUSED"
+	CodeIdempotencyKeyInProgress = "IDEMPOTENCY_KEY_IN_PROGRESS"
+	CodeUnauthorized             = "UNAUTHORIZED"
+	CodeForbidden                = "FORBIDDEN"
+	CodeInvalidSignature         = "INVALID_SIGNATURE"
+	CodeAPIKeyNotFound           = "API_KEY_NOT_FOUND"
+	CodeResetDisabled            = "RESET_DISABLED"
+	CodeInternal                 = "INTERNAL_ERROR"
+)
+
+// Error struct is the domain error of the application. Code is stable and safe to be checked by clients,
+// Message is human readable and may change. Fields hold every invalid field of the request, if any.
+type Error struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError struct describes a single invalid field of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func validationError(format string, args ...interface{}) *Error {
+	return newError(CodeValidationFailed, format, args...)
+}
+
+// notFound function replaces the "no rows" error with the domain error of the given code
+func notFound(err error, code, message string) error {
+	if err == sql.ErrNoRows {
+		return &Error{Code: code, Message: message}
+	}
+
+	return err
+}
+
+// fieldErrors type collects the invalid fields of the request, so the client is able to fix all of them at once
+type fieldErrors []FieldError
+
+func (fe *fieldErrors) add(field, format string, args ...interface{}) {
+	*fe = append(*fe, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// toError method returns nil when there is nothing invalid
+func (fe fieldErrors) toError(code, message string) error {
+	if len(fe) == 0 {
+		return nil
+	}
+
+	return &Error{Code: code, Message: message, Fields: fe}
+}
@@ -3,11 +3,21 @@ package models
 import (
 	"bidder/util"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 var resetQueries = []string{
+	"DELETE FROM idempotency_keys;",
+	"DELETE FROM signed_requests;",
+	"DELETE FROM balance_holds;",
+	"DELETE FROM ledger_entries;",
+	"DELETE FROM transfers;",
+	"DELETE FROM tournament_payouts;",
+	"DELETE FROM tournament_results;",
+	"DELETE FROM player_balances;",
+	"DELETE FROM tournament_waitlist;",
 	"DELETE FROM tournament_attendees;",
 	"DELETE FROM tournaments;",
 	"DELETE FROM players;",
@@ -39,3 +49,95 @@ func preparePostgresArray(array []string) string {
 
 	return fmt.Sprintf(`{%s}`, strings.Join(result, `, `))
 }
+
+func preparePostgresIntArray(array []int) string {
+	var result []string
+	for _, item := range array {
+		result = append(result, strconv.Itoa(item))
+	}
+
+	return fmt.Sprintf(`{%s}`, strings.Join(result, `, `))
+}
+
+// parsePostgresArray function splits the text representation of the one dimensional array
+func parsePostgresArray(array string) []string {
+	result := []string{}
+	if len(array) <= 2 {
+		return result
+	}
+
+	for _, item := range strings.Split(array[1:len(array)-1], ",") {
+		if unquoted, err := strconv.Unquote(item); err == nil {
+			item = unquoted
+		}
+
+		result = append(result, item)
+	}
+
+	return result
+}
+
+func parsePostgresIntArray(array string) ([]int, error) {
+	var result []int
+	for _, item := range parsePostgresArray(array) {
+		number, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, number)
+	}
+
+	return result, nil
+}
+
+// splitByStakes function divides the amount proportionally to the stakes.
+// The points left after the integer division are given one by one to the largest remainders
+// (the earlier stake wins a tie), so the shares always sum up to the whole amount.
+// Zero stakes in total are treated as equal ones.
+func splitByStakes(amount int, stakes []int) []int {
+	total := 0
+	for _, stake := range stakes {
+		total += stake
+	}
+
+	weights := stakes
+	if total == 0 {
+		weights = equalStakes(len(stakes))
+		total = len(weights)
+	}
+
+	shares := make([]int, len(weights))
+	remainders := make([]int64, len(weights))
+	left := amount
+	for i, weight := range weights {
+		product := int64(amount) * int64(weight)
+		shares[i] = int(product / int64(total))
+		remainders[i] = product % int64(total)
+		left -= shares[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+
+	for i := 0; i < left; i++ {
+		shares[order[i%len(order)]]++
+	}
+
+	return shares
+}
+
+// equalStakes function returns the same stake for every one of count players
+func equalStakes(count int) []int {
+	stakes := make([]int, count)
+	for i := range stakes {
+		stakes[i] = 1
+	}
+
+	return stakes
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"bidder/util"
+	"database/sql"
+	"time"
+)
+
+// Hold statuses. The active hold is expired once its expiry time has passed,
+// so it does not reserve anything anymore and cannot be captured.
+const (
+	HoldActive   = "active"
+	HoldCaptured = "captured"
+	HoldReleased = "released"
+	HoldExpired  = "expired"
+)
+
+const (
+	defaultHoldExpiry = time.Hour
+	maxHoldExpiry     = 30 * 24 * time.Hour
+)
+
+// Hold struct holds the part of the player's withdrawable balance reserved for the pending operation.
+// Captured hold is taken from the player, released one is returned to the available balance.
+type Hold struct {
+	ID         int        `json:"id"`
+	PlayerID   string     `json:"playerId"`
+	Currency   string     `json:"currency"`
+	Amount     int        `json:"amount"`
+	Reason     string     `json:"reason"`
+	Status     string     `json:"status"`
+	ExpiresIn  int        `json:"-"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// Validate method checks the params before execute actual request
+func (h *Hold) Validate() error {
+	if len(h.PlayerID) == 0 {
+		return validationError("PlayerID should not be empty!")
+	}
+
+	if h.Amount <= 0 {
+		return validationError("Amount should be positive number!")
+	}
+
+	if h.ExpiresIn < 0 || time.Duration(h.ExpiresIn)*time.Second > maxHoldExpiry {
+		return validationError("ExpiresIn should be between 1 second and %d seconds!", int(maxHoldExpiry.Seconds()))
+	}
+
+	return validateCurrency(&h.Currency)
+}
+
+// Place method reserves the amount of the player's available balance
+func (h *Hold) Place(key *IdempotencyKey) error {
+	tx, err := key.begin()
+	if err != nil {
+		return err
+	}
+
+	if err = h.checkAvailable(tx); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	if err = h.insert(tx); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	return key.commit(tx)
+}
+
+// Capture method takes the held amount from the player
+func (h *Hold) Capture(key *IdempotencyKey) error {
+	return h.resolve(key, HoldCaptured)
+}
+
+// Release method returns the held amount to the player's available balance
+func (h *Hold) Release(key *IdempotencyKey) error {
+	return h.resolve(key, HoldReleased)
+}
+
+// FindHold function returns the hold by its id
+func FindHold(id int) (*Hold, error) {
+	tx, err := util.DBConnect.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	hold := &Hold{ID: id}
+	if err = hold.find(tx, false); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return hold, tx.Commit()
+}
+
+// resolve method captures or releases the active hold. The player is locked before the hold,
+// in the same order as Take and JoinTournament lock him, so they never see the hold half-resolved.
+func (h *Hold) resolve(key *IdempotencyKey, status string) error {
+	tx, err := key.begin()
+	if err != nil {
+		return err
+	}
+
+	if err = h.find(tx, false); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	if _, _, err = lockBalance(tx, h.PlayerID, h.Currency); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	if err = h.find(tx, true); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	if h.Status != HoldActive {
+		key.rollback(tx)
+		return newError(CodeHoldNotActive, "Hold %d is %s", h.ID, h.Status)
+	}
+
+	if status == HoldCaptured {
+		entry := LedgerEntry{PlayerID: h.PlayerID, Type: EntryCapture, Currency: h.Currency, Amount: -h.Amount}
+		if err = entry.apply(tx); err != nil {
+			key.rollback(tx)
+			return err
+		}
+	}
+
+	if err = h.setStatus(tx, status); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	return key.commit(tx)
+}
+
+func (h *Hold) checkAvailable(tx *sql.Tx) error {
+	status, available, err := lockBalance(tx, h.PlayerID, h.Currency)
+	if err != nil {
+		return err
+	}
+
+	if err = checkPlayerActive(h.PlayerID, status); err != nil {
+		return err
+	}
+
+	if available < h.Amount {
+		return newError(CodeInsufficientFunds, "Player %s has only %d %s available", h.PlayerID, available, h.Currency)
+	}
+
+	return nil
+}
+
+func (h *Hold) insert(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`INSERT INTO balance_holds (player_id, currency, amount, reason, expires_at)
+                           VALUES ($1, $2, $3, $4, $5) RETURNING id, status, expires_at, created_at;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	expiry := defaultHoldExpiry
+	if h.ExpiresIn != 0 {
+		expiry = time.Duration(h.ExpiresIn) * time.Second
+	}
+
+	return stmt.QueryRow(h.PlayerID, h.Currency, h.Amount, h.Reason, time.Now().Add(expiry)).
+		Scan(&h.ID, &h.Status, &h.ExpiresAt, &h.CreatedAt)
+}
+
+// find method reads the hold, the active hold which has passed its expiry time is reported as expired
+func (h *Hold) find(tx *sql.Tx, lock bool) error {
+	query := `SELECT player_id, currency, amount, reason, status, expires_at, created_at, resolved_at, expires_at <= now()
+            FROM balance_holds WHERE id = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+
+	stmt, err := tx.Prepare(query + ";")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	var expired bool
+	err = stmt.QueryRow(h.ID).Scan(&h.PlayerID, &h.Currency, &h.Amount, &h.Reason, &h.Status,
+		&h.ExpiresAt, &h.CreatedAt, &h.ResolvedAt, &expired)
+	if err != nil {
+		return notFound(err, CodeHoldNotFound, "No such hold")
+	}
+
+	if h.Status == HoldActive && expired {
+		h.Status = HoldExpired
+	}
+
+	return nil
+}
+
+func (h *Hold) setStatus(tx *sql.Tx, status string) error {
+	stmt, err := tx.Prepare(`UPDATE balance_holds SET status = $2, resolved_at = now() WHERE id = $1 RETURNING resolved_at;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	var resolvedAt time.Time
+	if err = stmt.QueryRow(h.ID, status).Scan(&resolvedAt); err != nil {
+		return err
+	}
+
+	h.Status, h.ResolvedAt = status, &resolvedAt
+	return nil
+}
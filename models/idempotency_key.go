@@ -0,0 +1,183 @@
+package models
+
+import (
+	"bidder/util"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// ErrIdempotencyKeyReused is returned when the key was already used with another request
+var ErrIdempotencyKeyReused = newError(CodeIdempotencyKeyReused, "Idempotency key was already used with another request")
+
+// ErrIdempotencyKeyInProgress is returned when the first request with the key is not finished yet
+var ErrIdempotencyKeyInProgress = newError(CodeIdempotencyKeyInProgress, "Request with the same idempotency key is still in progress")
+
+// IdempotencyKey struct holds the client supplied key, the hash of the request made with it
+// and the response returned to that request. Every API key has its own idempotency keys.
+// The reserved key holds the transaction the operation of the request runs in,
+// so the operation is committed along with its response or not committed at all.
+type IdempotencyKey struct {
+	APIKeyID    int
+	Key         string
+	RequestHash string
+	StatusCode  int
+	Response    []byte
+
+	tx *sql.Tx
+}
+
+// Reserve method begins the transaction, stores the key for the new request in it and returns true.
+// The retry of the request in progress waits for it to finish up to IDEMPOTENCY_WAIT.
+// If the key is already known it loads the stored response into the struct and returns false.
+// The keys older than the TTL are forgotten.
+func (k *IdempotencyKey) Reserve() (bool, error) {
+	if err := forgetExpiredKeys(); err != nil {
+		return false, err
+	}
+
+	tx, err := util.DBConnect.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	reserved, err := k.reserveKey(tx)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if !reserved {
+		err = k.findResponse(tx)
+		tx.Rollback()
+		return false, err
+	}
+
+	k.tx = tx
+	return true, nil
+}
+
+// Save method stores the response for the reserved key and commits the transaction with the operation
+func (k *IdempotencyKey) Save() error {
+	result, err := k.tx.Exec(`UPDATE idempotency_keys SET status_code = $1, response = $2
+                            WHERE api_key_id = $3 AND key = $4 AND status_code IS NULL;`,
+		k.StatusCode, k.Response, k.APIKeyID, k.Key)
+	if err != nil {
+		k.tx.Rollback()
+		return err
+	}
+
+	if updated, err := result.RowsAffected(); err != nil || updated != 1 {
+		k.tx.Rollback()
+		return fmt.Errorf("cannot store the response for idempotency key %q", k.Key)
+	}
+
+	return k.tx.Commit()
+}
+
+// Release method rolls back the transaction with the key and the operation, so the request could be retried with it
+func (k *IdempotencyKey) Release() error {
+	return k.tx.Rollback()
+}
+
+// begin method returns the transaction for the operation. The operation of the request without the key
+// runs in its own transaction, the one made with the key runs in the transaction of the key under the savepoint,
+// so the failed operation is rolled back alone and the committed one waits for the response to be stored.
+func (k *IdempotencyKey) begin() (*sql.Tx, error) {
+	if k == nil {
+		return util.DBConnect.Begin()
+	}
+
+	if _, err := k.tx.Exec(`SAVEPOINT idempotent_operation;`); err != nil {
+		return nil, err
+	}
+
+	return k.tx, nil
+}
+
+// commit method finishes the operation started with begin
+func (k *IdempotencyKey) commit(tx *sql.Tx) error {
+	if k == nil {
+		return tx.Commit()
+	}
+
+	_, err := tx.Exec(`RELEASE SAVEPOINT idempotent_operation;`)
+	return err
+}
+
+// rollback method cancels the operation started with begin
+func (k *IdempotencyKey) rollback(tx *sql.Tx) {
+	if k == nil {
+		tx.Rollback()
+		return
+	}
+
+	tx.Exec(`ROLLBACK TO SAVEPOINT idempotent_operation;`)
+}
+
+func forgetExpiredKeys() error {
+	_, err := util.DBConnect.Exec(`DELETE FROM idempotency_keys WHERE created_at < now() - make_interval(secs => $1);`,
+		util.IdempotencyKeyTTL().Seconds())
+
+	return err
+}
+
+// reserveKey method inserts the new key. The insert waits while the key is held by the uncommitted request,
+// but not longer than IDEMPOTENCY_WAIT, and stores nothing if that request is committed.
+func (k *IdempotencyKey) reserveKey(tx *sql.Tx) (bool, error) {
+	_, err := tx.Exec(`SELECT set_config('lock_timeout', $1, true);`, fmt.Sprintf("%dms", util.IdempotencyWait().Milliseconds()))
+	if err != nil {
+		return false, err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO idempotency_keys (api_key_id, key, request_hash)
+                           VALUES ($1, $2, $3) ON CONFLICT(api_key_id, key) DO NOTHING RETURNING key;`)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	var key string
+	err = stmt.QueryRow(k.APIKeyID, k.Key, k.RequestHash).Scan(&key)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "lock_not_available" {
+		return false, ErrIdempotencyKeyInProgress
+	}
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`SET LOCAL lock_timeout TO DEFAULT;`)
+	return err == nil, err
+}
+
+func (k *IdempotencyKey) findResponse(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`SELECT request_hash, status_code, response FROM idempotency_keys
+                           WHERE api_key_id = $1 AND key = $2;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	var requestHash string
+	var statusCode sql.NullInt64
+	if err := stmt.QueryRow(k.APIKeyID, k.Key).Scan(&requestHash, &statusCode, &k.Response); err != nil {
+		return err
+	}
+
+	if requestHash != k.RequestHash {
+		return ErrIdempotencyKeyReused
+	}
+
+	if !statusCode.Valid {
+		return ErrIdempotencyKeyInProgress
+	}
+
+	k.StatusCode = int(statusCode.Int64)
+	return nil
+}
@@ -0,0 +1,344 @@
+package models
+
+import (
+	"bidder/util"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Ledger entry types. Every change of the player's points is written as one of them.
+const (
+	EntryOpening  = "opening"
+	EntryFund     = "fund"
+	EntryTake     = "take"
+	EntryDeposit  = "deposit"
+	EntryPrize    = "prize"
+	EntryRefund   = "refund"
+	EntryRelease  = "release"
+	EntryCapture  = "capture"
+	EntryTransfer = "transfer"
+)
+
+// LedgerEntry struct holds a single signed change of the player's balance in the currency.
+// TournamentID and AttendeeID are empty for the entries not related to any tournament,
+// TransferID is empty for the entries not related to any transfer.
+type LedgerEntry struct {
+	ID           int       `json:"id"`
+	PlayerID     string    `json:"playerId"`
+	TournamentID int       `json:"tournamentId,omitempty"`
+	AttendeeID   string    `json:"attendeeId,omitempty"`
+	TransferID   int       `json:"transferId,omitempty"`
+	Type         string    `json:"type"`
+	Currency     string    `json:"currency"`
+	Bucket       string    `json:"bucket"`
+	Amount       int       `json:"amount"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// apply method changes the player's balance in the entry currency and bucket by the entry amount and records the entry,
+// so every balance stored for the player is always equal to the sum of his entries in that currency and bucket.
+func (e *LedgerEntry) apply(tx *sql.Tx) error {
+	if len(e.Currency) == 0 {
+		e.Currency = DefaultCurrency
+	}
+
+	if len(e.Bucket) == 0 {
+		e.Bucket = BucketCash
+	}
+
+	var err error
+	if e.Amount >= 0 {
+		err = e.addToBalance(tx)
+	} else {
+		err = e.substractFromBalance(tx)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return e.insert(tx)
+}
+
+func (e *LedgerEntry) addToBalance(tx *sql.Tx) error {
+	column := bucketColumns[e.Bucket]
+	stmt, err := tx.Prepare(fmt.Sprintf(`INSERT INTO player_balances (player_id, currency, %[1]s) VALUES ($1, $2, $3)
+                           ON CONFLICT (player_id, currency) DO UPDATE SET %[1]s = player_balances.%[1]s + EXCLUDED.%[1]s;`, column))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err = stmt.Exec(e.PlayerID, e.Currency, e.Amount); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "foreign_key_violation" {
+			return newError(CodePlayerNotFound, "No such player")
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (e *LedgerEntry) substractFromBalance(tx *sql.Tx) error {
+	column := bucketColumns[e.Bucket]
+	stmt, err := tx.Prepare(fmt.Sprintf(`UPDATE player_balances SET %[1]s = %[1]s + $3
+                           WHERE player_id = $1 AND currency = $2 RETURNING %[1]s;`, column))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	// there is no balance to take from or it would become negative
+	var amount int
+	err = stmt.QueryRow(e.PlayerID, e.Currency, e.Amount).Scan(&amount)
+	if pqErr, ok := err.(*pq.Error); err == sql.ErrNoRows || ok && pqErr.Code.Name() == "check_violation" {
+		return newError(CodeInsufficientFunds, "Player %s has not enough %s in %s bucket", e.PlayerID, e.Currency, e.Bucket)
+	}
+
+	return err
+}
+
+func (e *LedgerEntry) insert(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`INSERT INTO ledger_entries (player_id, tournament_id, attendee_id, transfer_id, entry_type,
+                           currency, bucket, amount) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	tournamentID := sql.NullInt64{Int64: int64(e.TournamentID), Valid: e.TournamentID != 0}
+	attendeeID := sql.NullString{String: e.AttendeeID, Valid: len(e.AttendeeID) != 0}
+	transferID := sql.NullInt64{Int64: int64(e.TransferID), Valid: e.TransferID != 0}
+
+	return stmt.QueryRow(e.PlayerID, tournamentID, attendeeID, transferID, e.Type, e.Currency, e.Bucket, e.Amount).
+		Scan(&e.ID, &e.CreatedAt)
+}
+
+// TransactionsQuery struct holds the filters and pagination of the player's transaction history.
+// Cursor is the id of the last entry of the previous page, From and To are RFC3339 timestamps.
+// Zero or omitted Limit means the default page size.
+type TransactionsQuery struct {
+	PlayerID string   `json:"playerId"`
+	Types    []string `form:"type"`
+	Currency string   `form:"currency"`
+	From     string   `form:"from"`
+	To       string   `form:"to"`
+	Cursor   int      `form:"cursor"`
+	Limit    int      `form:"limit"`
+
+	from time.Time
+	to   time.Time
+}
+
+// TransactionsPage struct holds one page of the player's transaction history
+type TransactionsPage struct {
+	Transactions []LedgerEntry `json:"transactions"`
+	NextCursor   int           `json:"nextCursor,omitempty"`
+}
+
+const (
+	defaultTransactionsLimit = 50
+	maxTransactionsLimit     = 500
+)
+
+var entryTypes = map[string]bool{
+	EntryOpening:  true,
+	EntryFund:     true,
+	EntryTake:     true,
+	EntryDeposit:  true,
+	EntryPrize:    true,
+	EntryRefund:   true,
+	EntryRelease:  true,
+	EntryCapture:  true,
+	EntryTransfer: true,
+}
+
+// Validate method checks the params before execute actual request
+func (q *TransactionsQuery) Validate() error {
+	if len(q.PlayerID) == 0 {
+		return validationError("PlayerID should not be empty!")
+	}
+
+	for _, entryType := range q.Types {
+		if !entryTypes[entryType] {
+			return validationError("Unknown transaction type %q!", entryType)
+		}
+	}
+
+	if len(q.Currency) != 0 && !currencyFormat.MatchString(q.Currency) {
+		return validationError("Currency should be up to 16 letters, digits or underscores!")
+	}
+
+	if q.Cursor < 0 {
+		return validationError("Cursor should be positive number!")
+	}
+
+	if q.Limit < 0 || q.Limit > maxTransactionsLimit {
+		return validationError("Limit should be between 0 and %d, 0 means %d!", maxTransactionsLimit, defaultTransactionsLimit)
+	}
+
+	if q.Limit == 0 {
+		q.Limit = defaultTransactionsLimit
+	}
+
+	var err error
+	if len(q.From) != 0 {
+		if q.from, err = time.Parse(time.RFC3339, q.From); err != nil {
+			return validationError("From should be RFC3339 timestamp!")
+		}
+	}
+
+	if len(q.To) != 0 {
+		if q.to, err = time.Parse(time.RFC3339, q.To); err != nil {
+			return validationError("To should be RFC3339 timestamp!")
+		}
+	}
+
+	if !q.from.IsZero() && !q.to.IsZero() && q.from.After(q.to) {
+		return validationError("From should not be later than To!")
+	}
+
+	return nil
+}
+
+// Find method returns the page of the player's ledger entries, newest first
+func (q *TransactionsQuery) Find() (*TransactionsPage, error) {
+	tx, err := util.DBConnect.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = findPlayer(tx, q.PlayerID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	page, err := q.findEntries(tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return page, tx.Commit()
+}
+
+func (q *TransactionsQuery) findEntries(tx *sql.Tx) (*TransactionsPage, error) {
+	conditions := []string{"player_id = $1"}
+	args := []interface{}{q.PlayerID}
+
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if len(q.Types) != 0 {
+		addCondition("entry_type = ANY($%d)", preparePostgresArray(q.Types))
+	}
+	if len(q.Currency) != 0 {
+		addCondition("currency = $%d", q.Currency)
+	}
+	if q.Cursor != 0 {
+		addCondition("id < $%d", q.Cursor)
+	}
+	if !q.from.IsZero() {
+		addCondition("created_at >= $%d", q.from)
+	}
+	if !q.to.IsZero() {
+		addCondition("created_at < $%d", q.to)
+	}
+
+	// one extra entry tells whether there is a next page
+	args = append(args, q.Limit+1)
+	query := fmt.Sprintf(`SELECT id, player_id, tournament_id, attendee_id, transfer_id, entry_type, currency, bucket, amount, created_at
+                        FROM ledger_entries WHERE %s ORDER BY id DESC LIMIT $%d;`,
+		strings.Join(conditions, " AND "), len(args))
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &TransactionsPage{Transactions: []LedgerEntry{}}
+	for rows.Next() {
+		var entry LedgerEntry
+		var tournamentID, transferID sql.NullInt64
+		var attendeeID sql.NullString
+
+		err = rows.Scan(&entry.ID, &entry.PlayerID, &tournamentID, &attendeeID, &transferID, &entry.Type, &entry.Currency,
+			&entry.Bucket, &entry.Amount, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.TournamentID = int(tournamentID.Int64)
+		entry.AttendeeID = attendeeID.String
+		entry.TransferID = int(transferID.Int64)
+		page.Transactions = append(page.Transactions, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Transactions) > q.Limit {
+		page.Transactions = page.Transactions[:q.Limit]
+		page.NextCursor = page.Transactions[q.Limit-1].ID
+	}
+
+	return page, nil
+}
+
+// refundDeposits function returns the deposits charged for the tournament and not refunded yet.
+// The amounts are taken from the ledger, so everybody gets back exactly what he paid to the bucket he paid from.
+// If attendeeID is not empty only the deposit of that attendee and his backers is refunded.
+func refundDeposits(tx *sql.Tx, tournamentID int, attendeeID string) error {
+	stmt, err := tx.Prepare(`SELECT player_id, attendee_id, currency, bucket, -SUM(amount) FROM ledger_entries
+                           WHERE tournament_id = $1 AND entry_type = ANY($2) AND ($3 = '' OR attendee_id = $3)
+                           GROUP BY player_id, attendee_id, currency, bucket HAVING SUM(amount) < 0
+                           ORDER BY player_id, attendee_id;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(tournamentID, preparePostgresArray([]string{EntryDeposit, EntryRefund}), attendeeID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var refunds []LedgerEntry
+	for rows.Next() {
+		refund := LedgerEntry{TournamentID: tournamentID, Type: EntryRefund}
+		if err = rows.Scan(&refund.PlayerID, &refund.AttendeeID, &refund.Currency, &refund.Bucket, &refund.Amount); err != nil {
+			return err
+		}
+
+		refunds = append(refunds, refund)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, refund := range refunds {
+		if err = refund.apply(tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,140 +1,198 @@
 package models
 
 import (
-	"bidder/util"
 	"database/sql"
-	"errors"
+	"time"
 )
 
-// Player struct holds the player's data and allows to work with it in a handy way
+// Player struct holds the player's data and allows to work with it in a handy way.
+// Points are moved by Fund and Take in BalanceCurrency and Bucket, Balance holds the withdrawable balance
+// in the default currency and Balances hold every withdrawable balance of the player. Held is the part of it
+// reserved by the holds and Available is the rest. Bonus, Restricted and Wagering hold the promotional balances
+// and the wagering requirements by currency.
+// Profile fields are managed by the player registry only.
 type Player struct {
-	PlayerID string `form:"playerId" json:"playerId" binding:"required"`
-	Points   int    `form:"points" json:"balance" binding:"required"`
+	PlayerID        string         `form:"playerId" json:"playerId" binding:"required"`
+	Points          int            `form:"points" json:"-" binding:"required"`
+	BalanceCurrency string         `form:"currency" json:"-"`
+	Bucket          string         `form:"bucket" json:"-"`
+	Balance         int            `form:"-" json:"balance"`
+	Balances        map[string]int `form:"-" json:"balances"`
+	Available       map[string]int `form:"-" json:"available"`
+	Held            map[string]int `form:"-" json:"held,omitempty"`
+	Bonus           map[string]int `form:"-" json:"bonus,omitempty"`
+	Restricted      map[string]int `form:"-" json:"restricted,omitempty"`
+	Wagering        map[string]int `form:"-" json:"wagering,omitempty"`
+	DisplayName     string         `form:"-" json:"displayName"`
+	Currency        string         `form:"-" json:"currency"`
+	Region          string         `form:"-" json:"region"`
+	Status          string         `form:"-" json:"status"`
+	CreatedAt       time.Time      `form:"-" json:"createdAt"`
 }
 
 // Validate method checks the params before execute actual request
 func (p *Player) Validate() error {
 	if len(p.PlayerID) == 0 {
-		return errors.New("PlayerID should not be empty!")
+		return validationError("PlayerID should not be empty!")
 	}
 
 	if p.Points < 0 {
-		return errors.New("Points should be positive number!")
+		return validationError("Points should be positive number!")
 	}
 
-	return nil
+	if len(p.Bucket) == 0 {
+		p.Bucket = BucketCash
+	}
+
+	if p.Bucket != BucketCash && p.Bucket != BucketBonus {
+		return validationError("Bucket should be either cash or bonus!")
+	}
+
+	return validateCurrency(&p.BalanceCurrency)
 }
 
-// Fund method tries to create new player or update the existing one with some points
-func (p *Player) Fund() error {
-	tx, err := util.DBConnect.Begin()
+// Fund method adds some points to the registered active player
+func (p *Player) Fund(key *IdempotencyKey) error {
+	tx, err := key.begin()
 	if err != nil {
 		return err
 	}
 
 	err = p.fundPlayer(tx)
 	if err != nil {
-		tx.Rollback()
+		key.rollback(tx)
 		return err
 	}
 
-	return tx.Commit()
+	return key.commit(tx)
 }
 
-// Take method removes specified number of points from the player
+// FundCreating method registers the player if he is not registered yet and adds some points to him.
+// It is kept for the legacy fund endpoint only, new players should be registered explicitly.
+func (p *Player) FundCreating(key *IdempotencyKey) error {
+	tx, err := key.begin()
+	if err != nil {
+		return err
+	}
+
+	if err = p.createImplicitly(tx); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	if err = p.fundPlayer(tx); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	return key.commit(tx)
+}
+
+// Take method removes specified number of withdrawable points from the player
 // As this method has more than one database call, every call is in it's own method
-func (p *Player) Take() error {
-	tx, err := util.DBConnect.Begin()
+func (p *Player) Take(key *IdempotencyKey) error {
+	if p.Bucket != BucketCash {
+		return validationError("Only withdrawable points could be taken!")
+	}
+
+	tx, err := key.begin()
 	if err != nil {
 		return err
 	}
 
 	if err = p.checkPoints(tx); err != nil {
-		tx.Rollback()
+		key.rollback(tx)
 		return err
 	}
 
 	if err = p.substractPoints(tx); err != nil {
-		tx.Rollback()
+		key.rollback(tx)
 		return err
 	}
 
-	return tx.Commit()
+	return key.commit(tx)
 }
 
-// FindPlayer function tries to find and return the player from the DataBase
-func FindPlayer(playerID string) (*Player, error) {
-	tx, err := util.DBConnect.Begin()
+// FindPlayer function tries to find and return the player from the DataBase.
+// The request made with the idempotency key reads the player with it, so it sees its own operation.
+func FindPlayer(key *IdempotencyKey, playerID string) (*Player, error) {
+	tx, err := key.begin()
 	if err != nil {
 		return nil, err
 	}
 
 	player, err := findPlayer(tx, playerID)
 	if err != nil {
-		tx.Rollback()
+		key.rollback(tx)
 		return nil, err
 	}
 
-	return player, tx.Commit()
+	return player, key.commit(tx)
 }
 
-func (p *Player) fundPlayer(tx *sql.Tx) error {
-	stmt, err := tx.Prepare(`INSERT INTO players (player_id, points) VALUES ($1, $2)
-                           ON CONFLICT(player_id) DO UPDATE SET points = players.points + EXCLUDED.points;`)
+func (p *Player) createImplicitly(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`INSERT INTO players (player_id) VALUES ($1) ON CONFLICT(player_id) DO NOTHING;`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	if _, err := stmt.Exec(p.PlayerID, p.Points); err != nil {
+	_, err = stmt.Exec(p.PlayerID)
+	return err
+}
+
+func (p *Player) fundPlayer(tx *sql.Tx) error {
+	status, _, err := lockBalance(tx, p.PlayerID, p.BalanceCurrency)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	if err := checkPlayerActive(p.PlayerID, status); err != nil {
+		return err
+	}
+
+	entry := LedgerEntry{PlayerID: p.PlayerID, Type: EntryFund, Currency: p.BalanceCurrency, Bucket: p.Bucket, Amount: p.Points}
+	return entry.apply(tx)
 }
 
 func (p *Player) checkPoints(tx *sql.Tx) error {
-	stmt, err := tx.Prepare(`SELECT points FROM players WHERE player_id = $1 FOR UPDATE;`)
+	status, currentPoints, err := lockBalance(tx, p.PlayerID, p.BalanceCurrency)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
 
-	var currentPoints int
-	if err := stmt.QueryRow(p.PlayerID).Scan(&currentPoints); err != nil {
+	if err := checkPlayerActive(p.PlayerID, status); err != nil {
 		return err
 	}
 
 	if currentPoints-p.Points < 0 {
-		return errors.New("Can't set points number to negative")
+		return newError(CodeInsufficientFunds, "Can't set points number to negative")
 	}
 
 	return nil
 }
 
 func (p *Player) substractPoints(tx *sql.Tx) error {
-	stmt, err := tx.Prepare(`UPDATE players SET points = points - $1 WHERE player_id = $2;`)
-	if err != nil {
-		return err
-	}
-
-	_, err = stmt.Exec(p.Points, p.PlayerID)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	entry := LedgerEntry{PlayerID: p.PlayerID, Type: EntryTake, Currency: p.BalanceCurrency, Amount: -p.Points}
+	return entry.apply(tx)
 }
 
 func findPlayer(tx *sql.Tx, playerID string) (*Player, error) {
-	stmt, err := tx.Prepare(`SELECT player_id, points FROM players WHERE player_id = $1;`)
+	stmt, err := tx.Prepare(`SELECT player_id, display_name, currency, region, status, created_at
+                           FROM players WHERE player_id = $1;`)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
 	player := new(Player)
-	if err := stmt.QueryRow(playerID).Scan(&player.PlayerID, &player.Points); err != nil {
+	err = stmt.QueryRow(playerID).Scan(&player.PlayerID, &player.DisplayName,
+		&player.Currency, &player.Region, &player.Status, &player.CreatedAt)
+	if err != nil {
+		return nil, notFound(err, CodePlayerNotFound, "No such player")
+	}
+
+	if err = player.findBalances(tx); err != nil {
 		return nil, err
 	}
 
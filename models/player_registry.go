@@ -0,0 +1,232 @@
+package models
+
+import (
+	"bidder/util"
+	"database/sql"
+	"regexp"
+
+	"github.com/lib/pq"
+)
+
+// Player statuses. Only active players are allowed to move points,
+// suspended ones are frozen until activated again and closed ones are frozen forever.
+const (
+	PlayerActive    = "active"
+	PlayerSuspended = "suspended"
+	PlayerClosed    = "closed"
+)
+
+var playerStatuses = map[string]bool{
+	PlayerActive:    true,
+	PlayerSuspended: true,
+	PlayerClosed:    true,
+}
+
+var isoCurrencyFormat = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// ValidateProfile method checks the profile params before the player is registered or updated
+func (p *Player) ValidateProfile() error {
+	var invalidFields fieldErrors
+
+	if len(p.PlayerID) == 0 || len(p.PlayerID) > 256 {
+		invalidFields.add("playerId", "PlayerID should not be empty or longer than 256 characters")
+	}
+
+	if len(p.DisplayName) > 256 {
+		invalidFields.add("displayName", "Display name should not be longer than 256 characters")
+	}
+
+	if len(p.Currency) != 0 && !isoCurrencyFormat.MatchString(p.Currency) {
+		invalidFields.add("currency", "Currency should be ISO 4217 code, like EUR")
+	}
+
+	if len(p.Region) > 64 {
+		invalidFields.add("region", "Region should not be longer than 64 characters")
+	}
+
+	if len(p.Status) != 0 && !playerStatuses[p.Status] {
+		invalidFields.add("status", "Status should be one of active, suspended or closed")
+	}
+
+	return invalidFields.toError(CodeValidationFailed, "Player profile is invalid")
+}
+
+// Register method creates new active player without any points
+func (p *Player) Register() error {
+	tx, err := util.DBConnect.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = p.insertPlayer(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ProfileUpdate struct holds the profile fields to change. Fields which are not passed are left as they are.
+type ProfileUpdate struct {
+	DisplayName *string `json:"displayName"`
+	Currency    *string `json:"currency"`
+	Region      *string `json:"region"`
+	Status      *string `json:"status"`
+}
+
+// UpdateProfile method changes the passed profile fields and the status of the player, leaving the rest as they are.
+// Closed player cannot be changed anymore and the player holding any points cannot be closed.
+func (p *Player) UpdateProfile(update ProfileUpdate) error {
+	tx, err := util.DBConnect.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = p.lockProfile(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	update.applyTo(p)
+	if err = p.ValidateProfile(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if p.Status == PlayerClosed {
+		if err = p.checkNoFunds(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err = p.updatePlayer(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	updated, err := findPlayer(tx, p.PlayerID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	*p = *updated
+
+	return tx.Commit()
+}
+
+func (p *Player) insertPlayer(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`INSERT INTO players (player_id, display_name, currency, region, status)
+                           VALUES ($1, $2, $3, $4, $5) RETURNING created_at;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	p.Balances = map[string]int{}
+	p.Status = PlayerActive
+	err = stmt.QueryRow(p.PlayerID, p.DisplayName, p.Currency, p.Region, p.Status).Scan(&p.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return newError(CodePlayerExists, "Player %s already exists", p.PlayerID)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// lockProfile method locks the player and loads his current profile, so the concurrent updates never overwrite each other
+func (p *Player) lockProfile(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`SELECT display_name, currency, region, status FROM players WHERE player_id = $1 FOR UPDATE;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if err := stmt.QueryRow(p.PlayerID).Scan(&p.DisplayName, &p.Currency, &p.Region, &p.Status); err != nil {
+		return notFound(err, CodePlayerNotFound, "No such player")
+	}
+
+	if p.Status == PlayerClosed {
+		return newError(CodePlayerNotActive, "Player %s is closed", p.PlayerID)
+	}
+
+	return nil
+}
+
+// checkNoFunds method makes sure the player holds no points in any bucket, no active holds
+// and no deposits or stakes in the tournaments which are not over, so nothing is stranded on the closed account
+// and no refund or prize is ever paid to it
+func (p *Player) checkNoFunds(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`SELECT
+                             EXISTS (SELECT 1 FROM player_balances WHERE player_id = $1
+                                     AND (amount <> 0 OR bonus <> 0 OR restricted <> 0)),
+                             EXISTS (SELECT 1 FROM balance_holds WHERE player_id = $1
+                                     AND status = 'active' AND expires_at > now()),
+                             EXISTS (SELECT 1 FROM ledger_entries AS e JOIN tournaments AS t ON t.id = e.tournament_id
+                                     WHERE e.player_id = $1 AND e.entry_type = ANY($2) AND t.status = ANY($3)
+                                     GROUP BY e.tournament_id HAVING SUM(e.amount) < 0);`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	var hasBalance, hasHolds, hasDeposits bool
+	err = stmt.QueryRow(p.PlayerID, preparePostgresArray([]string{EntryDeposit, EntryRefund}),
+		preparePostgresArray([]string{TournamentAnnounced, TournamentRegistrationClosed, TournamentRunning})).
+		Scan(&hasBalance, &hasHolds, &hasDeposits)
+	if err != nil {
+		return err
+	}
+
+	if hasBalance || hasHolds {
+		return newError(CodePlayerHasFunds, "Player %s cannot be closed while he holds any points", p.PlayerID)
+	}
+
+	if hasDeposits {
+		return newError(CodePlayerHasFunds, "Player %s cannot be closed while his deposits are in the tournament", p.PlayerID)
+	}
+
+	return nil
+}
+
+func (p *Player) updatePlayer(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`UPDATE players SET display_name = $2, currency = $3, region = $4, status = $5
+                           WHERE player_id = $1 RETURNING created_at;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	return stmt.QueryRow(p.PlayerID, p.DisplayName, p.Currency, p.Region, p.Status).Scan(&p.CreatedAt)
+}
+
+// applyTo method copies every passed field to the player
+func (u ProfileUpdate) applyTo(player *Player) {
+	if u.DisplayName != nil {
+		player.DisplayName = *u.DisplayName
+	}
+
+	if u.Currency != nil {
+		player.Currency = *u.Currency
+	}
+
+	if u.Region != nil {
+		player.Region = *u.Region
+	}
+
+	if u.Status != nil {
+		player.Status = *u.Status
+	}
+}
+
+// checkPlayerActive function returns an error if the player with the status is not allowed to move points
+func checkPlayerActive(playerID, status string) error {
+	if status != PlayerActive {
+		return newError(CodePlayerNotActive, "Player %s is %s", playerID, status)
+	}
+
+	return nil
+}
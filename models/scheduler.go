@@ -0,0 +1,149 @@
+package models
+
+import (
+	"bidder/util"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// schedulerLockKey is the first key of the advisory locks taken by the scheduler, the tournament id is the second one.
+// Every replica runs the scheduler, so the lock makes sure the tournament is processed by one of them only.
+const schedulerLockKey = 725001
+
+// RunScheduler function processes the due tournaments every interval. It never returns.
+func RunScheduler(interval time.Duration) {
+	for range time.Tick(interval) {
+		processed, err := ProcessDueTournaments()
+		if err != nil {
+			log.Printf("Scheduler failed due to error: %s", err)
+		}
+
+		if processed != 0 {
+			log.Printf("Scheduler processed %d tournaments", processed)
+		}
+	}
+}
+
+// ProcessDueTournaments function closes the registration of every announced tournament which should be started already.
+// The tournament which has not got MinAttendees is cancelled instead and the deposits are refunded,
+// the one whose registration was closed by the operator before is cancelled as well.
+// It returns the number of the processed tournaments. The tournament failed to be processed is retried next time.
+func ProcessDueTournaments() (int, error) {
+	tournamentIDs, err := findDueTournaments()
+	if err != nil {
+		return 0, err
+	}
+
+	processed := 0
+	for _, tournamentID := range tournamentIDs {
+		done, err := processDueTournament(tournamentID)
+		if err != nil {
+			log.Printf("Tournament %d is not processed due to error: %s", tournamentID, err)
+			continue
+		}
+
+		if done {
+			processed++
+		}
+	}
+
+	return processed, nil
+}
+
+func findDueTournaments() ([]int, error) {
+	stmt, err := util.DBConnect.Prepare(`SELECT t.id FROM tournaments AS t WHERE t.starts_at <= now()
+                                       AND (t.status = $1 OR t.status = $2 AND t.min_attendees >
+                                         (SELECT COUNT(*) FROM tournament_attendees AS ta WHERE ta.tournament_id = t.id))
+                                       ORDER BY t.starts_at, t.id;`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(TournamentAnnounced, TournamentRegistrationClosed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tournamentIDs []int
+	for rows.Next() {
+		var tournamentID int
+		if err = rows.Scan(&tournamentID); err != nil {
+			return nil, err
+		}
+
+		tournamentIDs = append(tournamentIDs, tournamentID)
+	}
+
+	return tournamentIDs, rows.Err()
+}
+
+// processDueTournament function closes or cancels the tournament within its own transaction.
+// The tournament locked by another replica or changed since it was found is skipped.
+func processDueTournament(tournamentID int) (bool, error) {
+	tx, err := util.DBConnect.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	locked, err := trySchedulerLock(tx, tournamentID)
+	if err != nil || !locked {
+		tx.Rollback()
+		return false, err
+	}
+
+	tournament := Tournament{TournamentID: tournamentID}
+	due, err := tournament.lockDue(tx)
+	if err != nil || !due {
+		tx.Rollback()
+		return false, err
+	}
+
+	if tournament.AttendeesCount < tournament.MinAttendees {
+		err = tournament.cancel(tx)
+	} else if tournament.Status == TournamentAnnounced {
+		err = setTournamentStatus(tx, tournamentID, TournamentRegistrationClosed)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// trySchedulerLock function takes the advisory lock of the tournament until the end of the transaction,
+// without waiting for the replica holding it
+func trySchedulerLock(tx *sql.Tx, tournamentID int) (bool, error) {
+	var locked bool
+	err := tx.QueryRow(`SELECT pg_try_advisory_xact_lock($1, $2);`, schedulerLockKey, tournamentID).Scan(&locked)
+	return locked, err
+}
+
+// lockDue method locks the tournament and tells whether it should be started already and is still announced,
+// or has its registration closed without enough attendees
+func (t *Tournament) lockDue(tx *sql.Tx) (bool, error) {
+	stmt, err := tx.Prepare(`SELECT t.status, t.min_attendees, t.starts_at <= now(),
+                           (SELECT COUNT(*) FROM tournament_attendees AS ta WHERE ta.tournament_id = t.id)
+                           FROM tournaments AS t WHERE t.id = $1 FOR UPDATE OF t;`)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	var started sql.NullBool
+	err = stmt.QueryRow(t.TournamentID).Scan(&t.Status, &t.MinAttendees, &started, &t.AttendeesCount)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	closedShort := t.Status == TournamentRegistrationClosed && t.AttendeesCount < t.MinAttendees
+	return started.Bool && (t.Status == TournamentAnnounced || closedShort), nil
+}
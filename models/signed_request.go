@@ -0,0 +1,49 @@
+package models
+
+import (
+	"bidder/util"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SignedRequest struct holds the verified signature of the partner's request. It is registered
+// in the transaction of the operation it signs, so the request which was not applied could be retried.
+type SignedRequest struct {
+	PartnerID string
+	Signature string
+}
+
+// register method remembers the signature and returns an error if it was already used.
+// Signatures older than the window are forgotten, as such requests are stale anyway.
+func (r *SignedRequest) register(tx *sql.Tx) error {
+	if err := forgetSignatures(time.Now().Add(-2 * util.SignatureWindow())); err != nil {
+		return err
+	}
+
+	return insertSignature(tx, r.PartnerID, r.Signature)
+}
+
+func forgetSignatures(before time.Time) error {
+	_, err := util.DBConnect.Exec(`DELETE FROM signed_requests WHERE created_at < $1;`, before)
+	return err
+}
+
+func insertSignature(tx *sql.Tx, partnerID, signature string) error {
+	stmt, err := tx.Prepare(`INSERT INTO signed_requests (signature, partner_id) VALUES ($1, $2);`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err = stmt.Exec(signature, partnerID); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return newError(CodeInvalidSignature, "Signed request was already received")
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -3,21 +3,45 @@ package models
 import (
 	"bidder/util"
 	"database/sql"
-	"errors"
-	"strings"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
 )
 
-// Tournament struct holds tournament related data and helps to process it
+// Tournament struct holds tournament related data and helps to process it.
+// TournamentID is allocated on announce when it is not passed.
+// GuaranteedPool is the prize pool paid even if the collected deposits are smaller.
+// Deposit and prizes are paid in Currency, points by default.
+// Zero MaxAttendees means the tournament is not limited.
+// AttendeesCount, Pool and Results are filled only when the tournament is read back.
 type Tournament struct {
-	TournamentID int  `form:"tournamentId" json:"tournamentId" binding:"required"`
-	Deposit      int  `form:"deposit" json:"deposit" binding:"required"`
-	Finished     bool `json:"finished"`
+	TournamentID   int        `form:"tournamentId" json:"tournamentId"`
+	Deposit        int        `form:"deposit" json:"deposit" binding:"required"`
+	GuaranteedPool int        `form:"guaranteedPool" json:"guaranteedPool"`
+	Currency       string     `form:"currency" json:"currency"`
+	Name           string     `form:"name" json:"name"`
+	GameType       string     `form:"gameType" json:"gameType"`
+	StartsAt       *time.Time `form:"startsAt" json:"startsAt,omitempty" time_format:"2006-01-02T15:04:05Z07:00"`
+	MaxAttendees   int        `form:"maxAttendees" json:"maxAttendees"`
+	MinAttendees   int        `form:"minAttendees" json:"minAttendees"`
+	Status         string     `form:"-" json:"status"`
+	AttendeesCount int        `form:"-" json:"attendeesCount"`
+	Pool           int        `form:"-" json:"pool"`
+	Results        []Winner   `form:"-" json:"results,omitempty"`
 }
 
 // TournamentResult struct holds the data required to process result finish
 type TournamentResult struct {
 	TournamentID string   `form:"tournamentId" json:"tournamentId" binding:"required"`
 	Winners      []Winner `form:"winners" json:"winners" binding:"required"`
+
+	// Signature is the partner's signature of the result, if the result is signed
+	Signature *SignedRequest `form:"-" json:"-"`
+
+	tournamentID int
+	currency     string
 }
 
 // Winner struct holds winner related data. Helper struct to work with TournamentResult struct
@@ -28,151 +52,393 @@ type Winner struct {
 
 // Validate method checks the params before execute actual request
 func (t *Tournament) Validate() error {
-	if t.TournamentID <= 0 {
-		return errors.New("TournamentID should be positive number!")
+	if t.TournamentID < 0 {
+		return validationError("TournamentID should be positive number!")
 	}
 
 	if t.Deposit < 0 {
-		return errors.New("Deposit should be positive number!")
+		return validationError("Deposit should be positive number!")
 	}
 
-	return nil
+	if t.GuaranteedPool < 0 {
+		return validationError("GuaranteedPool should be positive number!")
+	}
+
+	if len(t.Name) > 256 {
+		return validationError("Name should not be longer than 256 characters!")
+	}
+
+	if len(t.GameType) > 64 {
+		return validationError("GameType should not be longer than 64 characters!")
+	}
+
+	if t.MaxAttendees < 0 || t.MinAttendees < 0 {
+		return validationError("MaxAttendees and MinAttendees should be positive numbers!")
+	}
+
+	if t.MaxAttendees != 0 && t.MinAttendees > t.MaxAttendees {
+		return validationError("MinAttendees should not exceed MaxAttendees!")
+	}
+
+	return validateCurrency(&t.Currency)
 }
 
 // Announce method tries to create new tournament in the DataBase
-func (t *Tournament) Announce() error {
-	tx, err := util.DBConnect.Begin()
+func (t *Tournament) Announce(key *IdempotencyKey) error {
+	tx, err := key.begin()
 	if err != nil {
 		return err
 	}
 
 	err = t.newTournament(tx)
 	if err != nil {
-		tx.Rollback()
+		key.rollback(tx)
 		return err
 	}
 
-	return tx.Commit()
+	return key.commit(tx)
 }
 
+// tournamentIDSequence is the sequence the tournament ids are allocated from
+const tournamentIDSequence = `pg_get_serial_sequence('tournaments', 'id')`
+
+// tournamentIDLockKey is the key of the advisory lock taken while the id sequence is moved past the passed id,
+// so the concurrent announces never move it backwards
+const tournamentIDLockKey = 725002
+
+// allocateTournamentIDAttempts is how many times the id is allocated again,
+// if the allocated one is taken by the tournament announced with the passed id meanwhile
+const allocateTournamentIDAttempts = 5
+
+// newTournament method inserts the tournament, allocating its id when it is not passed
 func (t *Tournament) newTournament(tx *sql.Tx) error {
-	stmt, err := tx.Prepare(`INSERT INTO tournaments (id, deposit, finished) VALUES ($1, $2, $3);`)
+	t.Status = TournamentAnnounced
+	if t.TournamentID != 0 {
+		if err := t.insertTournament(tx, t.TournamentID); err != nil {
+			return err
+		}
+
+		return t.skipTournamentID(tx)
+	}
+
+	for attempt := 0; attempt < allocateTournamentIDAttempts; attempt++ {
+		if _, err := tx.Exec(`SAVEPOINT new_tournament;`); err != nil {
+			return err
+		}
+
+		err := t.insertTournament(tx, 0)
+		if err == nil {
+			_, err = tx.Exec(`RELEASE SAVEPOINT new_tournament;`)
+			return err
+		}
+
+		if domainError, ok := err.(*Error); !ok || domainError.Code != CodeTournamentExists {
+			return err
+		}
+
+		if _, err = tx.Exec(`ROLLBACK TO SAVEPOINT new_tournament;`); err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("cannot allocate tournament id in %d attempts", allocateTournamentIDAttempts)
+}
+
+// insertTournament method inserts the tournament with the given id, the zero one is allocated from the sequence
+func (t *Tournament) insertTournament(tx *sql.Tx, tournamentID int) error {
+	stmt, err := tx.Prepare(`INSERT INTO tournaments (id, deposit, guaranteed_pool, currency, status,
+                           name, game_type, starts_at, max_attendees, min_attendees)
+                           VALUES (COALESCE(NULLIF($1, 0), nextval(` + tournamentIDSequence + `)),
+                           $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id;`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	if _, err := stmt.Exec(t.TournamentID, t.Deposit, t.Finished); err != nil {
+	err = stmt.QueryRow(tournamentID, t.Deposit, t.GuaranteedPool, t.Currency, t.Status,
+		t.Name, t.GameType, t.StartsAt, t.MaxAttendees, t.MinAttendees).Scan(&t.TournamentID)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+		return newError(CodeTournamentExists, "Tournament %d already exists", tournamentID)
+	}
+
+	return err
+}
+
+// skipTournamentID method moves the id sequence past the id passed by the client,
+// so the allocated ids never clash with it. The sequence is only moved forward.
+func (t *Tournament) skipTournamentID(tx *sql.Tx) error {
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1);`, tournamentIDLockKey); err != nil {
 		return err
 	}
 
-	return nil
+	stmt, err := tx.Prepare(`SELECT setval(seq.name::regclass, $1)
+                           FROM (SELECT ` + tournamentIDSequence + ` AS name) AS seq
+                           JOIN pg_sequences AS s ON quote_ident(s.schemaname) || '.' || quote_ident(s.sequencename) = seq.name
+                           WHERE $1 > COALESCE(s.last_value, 0);`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(t.TournamentID)
+	return err
 }
 
 // Validate method checks the params before execute actual request
 func (tr *TournamentResult) Validate() error {
 	if len(tr.TournamentID) == 0 {
-		return errors.New("TournamentID should not empty!")
+		return validationError("TournamentID should not empty!")
+	}
+
+	tournamentID, err := strconv.Atoi(tr.TournamentID)
+	if err != nil || tournamentID <= 0 {
+		return validationError("TournamentID should be positive number!")
 	}
+	tr.tournamentID = tournamentID
 
 	if len(tr.Winners) == 0 {
-		return errors.New("Winners array should not be empty!")
+		return validationError("Winners array should not be empty!")
 	}
 
-	return nil
+	var invalidFields fieldErrors
+	uniqValidator := make(map[string]bool)
+
+	for i, winner := range tr.Winners {
+		if winner.Prize < 0 {
+			invalidFields.add(fmt.Sprintf("winners[%d].prize", i), "Prize should be positive number")
+		}
+
+		if uniqValidator[winner.PlayerID] {
+			invalidFields.add(fmt.Sprintf("winners[%d].playerId", i), "Every winner should be uniq")
+		}
+		uniqValidator[winner.PlayerID] = true
+	}
+
+	return invalidFields.toError(CodeInvalidWinners, "Winners are invalid")
 }
 
 // Finish method tries to finish the tournament and pay the prize for every player
 // As this method has more than one database call, each call is in it's own method.
-func (tr *TournamentResult) Finish() error {
-	tx, err := util.DBConnect.Begin()
+func (tr *TournamentResult) Finish(key *IdempotencyKey) error {
+	tx, err := key.begin()
 	if err != nil {
 		return err
 	}
 
+	if err = tr.registerSignature(tx); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
 	if err = tr.checkTournament(tx); err != nil {
-		tx.Rollback()
+		key.rollback(tx)
+		return err
+	}
+
+	if err = tr.checkWinners(tx); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	if err = tr.checkPrizePool(tx); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	if err = wagerDeposits(tx, tr.tournamentID); err != nil {
+		key.rollback(tx)
 		return err
 	}
 
 	if err = tr.updateWinners(tx); err != nil {
-		tx.Rollback()
+		key.rollback(tx)
+		return err
+	}
+
+	if err = releaseRestricted(tx, tr.tournamentID); err != nil {
+		key.rollback(tx)
 		return err
 	}
 
 	if err = tr.finishTournament(tx); err != nil {
-		tx.Rollback()
+		key.rollback(tx)
 		return err
 	}
 
-	return tx.Commit()
+	return key.commit(tx)
+}
+
+// registerSignature method rejects the signed result which was already received, so it is never paid twice
+func (tr *TournamentResult) registerSignature(tx *sql.Tx) error {
+	if tr.Signature == nil {
+		return nil
+	}
+
+	return tr.Signature.register(tx)
 }
 
 func (tr *TournamentResult) checkTournament(tx *sql.Tx) error {
-	stmt, err := tx.Prepare(`SELECT finished FROM tournaments WHERE id = $1 FOR UPDATE;`)
+	tournament := Tournament{TournamentID: tr.tournamentID}
+	if err := tournament.lockStatus(tx); err != nil {
+		return err
+	}
+
+	return checkTransition(tournament.Status, TournamentFinished)
+}
+
+// checkWinners method makes sure every winner is registered in the tournament
+func (tr *TournamentResult) checkWinners(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`SELECT player_id FROM tournament_attendees WHERE tournament_id = $1;`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	var finished bool
-	if err := stmt.QueryRow(tr.TournamentID).Scan(&finished); err != nil {
+	rows, err := stmt.Query(tr.tournamentID)
+	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
-	if finished {
-		return errors.New("Cannot finish finished tournament")
+	attendees := make(map[string]bool)
+	for rows.Next() {
+		var playerID string
+		if err = rows.Scan(&playerID); err != nil {
+			return err
+		}
+
+		attendees[playerID] = true
 	}
 
-	return nil
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	var invalidFields fieldErrors
+	for i, winner := range tr.Winners {
+		if !attendees[winner.PlayerID] {
+			invalidFields.add(fmt.Sprintf("winners[%d].playerId", i), "Winner is not registered in the tournament")
+		}
+	}
+
+	return invalidFields.toError(CodeInvalidWinners, "Winners are invalid")
 }
 
-func (tr *TournamentResult) updateWinners(tx *sql.Tx) error {
-	stmt, err := tx.Prepare(`UPDATE players SET points = points + $1 WHERE player_id = ANY($2);`)
+// checkPrizePool method makes sure the prizes do not exceed the collected deposits
+// or the guaranteed pool of the tournament, whichever is bigger
+func (tr *TournamentResult) checkPrizePool(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`SELECT t.guaranteed_pool, t.currency, COALESCE(-SUM(le.amount), 0) FROM tournaments AS t
+                           LEFT JOIN ledger_entries AS le ON le.tournament_id = t.id AND le.entry_type = ANY($2)
+                           WHERE t.id = $1 GROUP BY t.id;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	var guaranteedPool, collected int
+	err = stmt.QueryRow(tr.tournamentID, preparePostgresArray([]string{EntryDeposit, EntryRefund})).Scan(&guaranteedPool, &tr.currency, &collected)
 	if err != nil {
 		return err
 	}
 
+	pool := collected
+	if guaranteedPool > pool {
+		pool = guaranteedPool
+	}
+
+	prizes := 0
 	for _, winner := range tr.Winners {
-		var backers []byte
-		var playerID string
-		var ids []string
+		prizes += winner.Prize
+	}
+
+	if prizes > pool {
+		return newError(CodePrizePoolExceeded, "Prizes in total (%d) should not exceed the prize pool (%d)", prizes, pool)
+	}
+
+	return nil
+}
 
-		err = tx.QueryRow(`SELECT p.player_id, ta.backers FROM players AS p
+// updateWinners method pays the prize of every winner and stores the result with the payouts,
+// so the players are able to see what they were paid
+func (tr *TournamentResult) updateWinners(tx *sql.Tx) error {
+	for position, winner := range tr.Winners {
+		var backers, backerStakes []byte
+		attendee := TournamentAttendee{TournamentID: tr.tournamentID}
+
+		err := tx.QueryRow(`SELECT p.player_id, ta.backers, ta.stake, ta.backer_stakes FROM players AS p
 											 JOIN tournament_attendees AS ta ON p.player_id = ta.player_id
 											 WHERE p.player_id = $1 AND ta.tournament_id = $2 FOR UPDATE;`,
-			winner.PlayerID, tr.TournamentID).Scan(&playerID, &backers)
+			winner.PlayerID, tr.tournamentID).Scan(&attendee.PlayerID, &backers, &attendee.Stake, &backerStakes)
 
 		if err != nil {
 			return err
 		}
 
-		b := string(backers)
-		if b == "{}" {
-			ids = []string{playerID}
-		} else {
-			ids = append(strings.Split(b[1:len(b)-1], ","), playerID)
+		attendee.Backers = parsePostgresArray(string(backers))
+		if attendee.BackerStakes, err = parsePostgresIntArray(string(backerStakes)); err != nil {
+			return err
+		}
+
+		paid, err := paidByBuckets(tx, tr.tournamentID, attendee.PlayerID)
+		if err != nil {
+			return err
 		}
 
-		prize := winner.Prize / len(ids)
-		playerIDs := preparePostgresArray(ids)
-		if _, err = stmt.Exec(prize, playerIDs); err != nil {
+		resultID, err := insertResult(tx, tr.tournamentID, position+1, winner)
+		if err != nil {
 			return err
 		}
+
+		// the prize is shared in the same proportion as the deposit was paid
+		ids := attendee.playerIDs()
+		prizes := splitByStakes(winner.Prize, attendee.stakes())
+		for i, id := range ids {
+			if err = tr.payPrize(tx, resultID, attendee.PlayerID, id, prizes[i], paid[id]); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
-func (tr *TournamentResult) finishTournament(tx *sql.Tx) error {
-	stmt, err := tx.Prepare(`UPDATE tournaments SET finished = true WHERE id = $1;`)
-	if err != nil {
+// payPrize method pays the prize to the player. The part of it won with the promotional money is restricted
+// and has to be wagered before it could be withdrawn.
+func (tr *TournamentResult) payPrize(tx *sql.Tx, resultID int, attendeeID, playerID string, prize int, paid map[string]int) error {
+	restricted := restrictedPart(prize, paid[BucketCash], paid[BucketBonus]+paid[BucketRestricted])
+	payout := Payout{PlayerID: playerID, Currency: tr.currency, Amount: prize, Restricted: restricted}
+	if err := insertPayout(tx, resultID, payout); err != nil {
 		return err
 	}
 
-	if _, err = stmt.Exec(tr.TournamentID); err != nil {
+	entry := LedgerEntry{
+		PlayerID:     playerID,
+		TournamentID: tr.tournamentID,
+		AttendeeID:   attendeeID,
+		Type:         EntryPrize,
+		Currency:     tr.currency,
+		Bucket:       BucketCash,
+		Amount:       prize - restricted,
+	}
+
+	if entry.Amount != 0 || restricted == 0 {
+		if err := entry.apply(tx); err != nil {
+			return err
+		}
+	}
+
+	if restricted == 0 {
+		return nil
+	}
+
+	entry.ID, entry.Bucket, entry.Amount = 0, BucketRestricted, restricted
+	if err := entry.apply(tx); err != nil {
 		return err
 	}
 
-	return nil
+	return addWagering(tx, playerID, tr.currency, restricted*util.WageringMultiplier())
+}
+
+func (tr *TournamentResult) finishTournament(tx *sql.Tx) error {
+	return setTournamentStatus(tx, tr.tournamentID, TournamentFinished)
 }
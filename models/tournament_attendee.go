@@ -3,27 +3,44 @@ package models
 import (
 	"bidder/util"
 	"database/sql"
-	"errors"
+	"strconv"
+	"strings"
 )
 
-// TournamentAttendee struct holds attendee related data and helps to process it
+// TournamentAttendee struct holds attendee related data and helps to process it.
+// Every backer may be passed with his stake in points (P2:300) or in percents of the deposit (P2:30%).
+// The player's own stake is the rest of the deposit. Backers passed without stakes share the deposit equally.
+// When the tournament is full the attendee asked for the Waitlist is Waitlisted and charged on promotion only.
 type TournamentAttendee struct {
 	TournamentID int      `form:"tournamentId" json:"tournamentId" binding:"required"`
 	PlayerID     string   `form:"playerId" json:"playerId" binding:"required"`
-	Backers      []string `form:"backerId"`
+	Backers      []string `form:"backerId" json:"backers"`
+	Stake        int      `form:"-" json:"stake"`
+	BackerStakes []int    `form:"-" json:"backerStakes"`
+	Waitlist     bool     `form:"waitlist" json:"-"`
+	Waitlisted   bool     `form:"-" json:"waitlisted"`
+
+	backerShares []int
+	percents     bool
+	currency     string
+	full         bool
 }
 
 // Validate method checks the params before execute actual request
 func (ta *TournamentAttendee) Validate() error {
 	if len(ta.PlayerID) == 0 {
-		return errors.New("PlayerID should not be empty!")
+		return validationError("PlayerID should not be empty!")
 	}
 
 	if ta.TournamentID < 0 {
-		return errors.New("TournamentID should be positive number!")
+		return validationError("TournamentID should be positive number!")
 	}
 
-	validationPlayers := append(ta.Backers, ta.PlayerID)
+	if err := ta.parseBackers(); err != nil {
+		return err
+	}
+
+	validationPlayers := ta.playerIDs()
 	uniqValidator := make(map[string]bool)
 
 	for _, id := range validationPlayers {
@@ -31,7 +48,7 @@ func (ta *TournamentAttendee) Validate() error {
 	}
 
 	if len(uniqValidator) < len(validationPlayers) {
-		return errors.New("Every player should be uniq!")
+		return validationError("Every player should be uniq!")
 	}
 
 	return nil
@@ -39,29 +56,90 @@ func (ta *TournamentAttendee) Validate() error {
 
 // JoinTournament method tries to join the tournament by provided users
 // As this method has more than one database call, each call is in it's own method.
-func (ta *TournamentAttendee) JoinTournament() error {
-	tx, err := util.DBConnect.Begin()
+func (ta *TournamentAttendee) JoinTournament(key *IdempotencyKey) error {
+	tx, err := key.begin()
 	if err != nil {
 		return err
 	}
 
 	deposit, err := ta.getTournamentDeposit(tx)
 	if err != nil {
-		tx.Rollback()
+		key.rollback(tx)
 		return err
 	}
 
 	if err = ta.checkUniqAttendee(tx); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	if err = ta.checkNotWaitlisted(tx); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	if err = ta.resolveStakes(deposit); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	if ta.full {
+		if err = ta.joinWaitlist(tx); err != nil {
+			key.rollback(tx)
+			return err
+		}
+
+		return key.commit(tx)
+	}
+
+	if err = ta.updateAttendeeProfiles(tx); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	if err = ta.addAttendee(tx); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	return key.commit(tx)
+}
+
+// LeaveTournament method removes the attendee from the tournament which is not started yet
+// and refunds the deposit to the player and his backers. The free seat goes to the first waitlisted attendee.
+// The waitlisted attendee just leaves the waitlist.
+func (ta *TournamentAttendee) LeaveTournament() error {
+	tx, err := util.DBConnect.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = ta.checkLeaveAllowed(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	waitlisted, err := ta.leaveWaitlist(tx)
+	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	if err = ta.updateAttendeeProfiles(tx, deposit); err != nil {
+	if waitlisted {
+		return tx.Commit()
+	}
+
+	if err = refundDeposits(tx, ta.TournamentID, ta.PlayerID); err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	if err = ta.addAttendee(tx); err != nil {
+	if err = ta.removeAttendee(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = promoteWaitlisted(tx, ta.TournamentID); err != nil {
 		tx.Rollback()
 		return err
 	}
@@ -69,23 +147,102 @@ func (ta *TournamentAttendee) JoinTournament() error {
 	return tx.Commit()
 }
 
+// parseBackers method splits the backers passed with stakes into the ids and the shares
+func (ta *TournamentAttendee) parseBackers() error {
+	withShares := 0
+
+	for i, backer := range ta.Backers {
+		separator := strings.LastIndex(backer, ":")
+		if separator < 0 {
+			continue
+		}
+
+		share := backer[separator+1:]
+		percents := strings.HasSuffix(share, "%")
+		if withShares > 0 && percents != ta.percents {
+			return validationError("Backer stakes should be either all in points or all in percents!")
+		}
+		ta.percents = percents
+
+		number, err := strconv.Atoi(strings.TrimSuffix(share, "%"))
+		if err != nil || number <= 0 {
+			return validationError("Backer stake should be positive number!")
+		}
+
+		if ta.backerShares == nil {
+			ta.backerShares = make([]int, len(ta.Backers))
+		}
+		ta.backerShares[i] = number
+		ta.Backers[i] = backer[:separator]
+		withShares++
+	}
+
+	if withShares > 0 && withShares < len(ta.Backers) {
+		return validationError("Either every backer or none of them should have a stake!")
+	}
+
+	return nil
+}
+
+// resolveStakes method calculates the points every player pays for the deposit.
+// The stakes always sum up to the deposit.
+func (ta *TournamentAttendee) resolveStakes(deposit int) error {
+	if ta.backerShares == nil {
+		stakes := splitByStakes(deposit, equalStakes(len(ta.Backers)+1))
+		ta.Stake, ta.BackerStakes = stakes[0], stakes[1:]
+		return nil
+	}
+
+	total := 0
+	for _, share := range ta.backerShares {
+		total += share
+	}
+
+	if ta.percents {
+		if total > 100 {
+			return validationError("Backer stakes should not exceed 100 percents!")
+		}
+
+		stakes := splitByStakes(deposit, append([]int{100 - total}, ta.backerShares...))
+		ta.Stake, ta.BackerStakes = stakes[0], stakes[1:]
+		return nil
+	}
+
+	if total > deposit {
+		return validationError("Backer stakes should not exceed the deposit!")
+	}
+
+	ta.Stake, ta.BackerStakes = deposit-total, ta.backerShares
+	return nil
+}
+
+// stakes method returns the stakes in the same order as playerIDs method
+func (ta *TournamentAttendee) stakes() []int {
+	return append([]int{ta.Stake}, ta.BackerStakes...)
+}
+
+// getTournamentDeposit method locks the tournament, so the seats are counted while nobody else joins or leaves it
 func (ta *TournamentAttendee) getTournamentDeposit(tx *sql.Tx) (int, error) {
-	stmt, err := tx.Prepare(`SELECT deposit, finished FROM tournaments WHERE id = $1 FOR UPDATE;`)
+	stmt, err := tx.Prepare(`SELECT t.deposit, t.currency, t.status, t.max_attendees,
+                           (SELECT COUNT(*) FROM tournament_attendees AS ta WHERE ta.tournament_id = t.id)
+                           FROM tournaments AS t WHERE t.id = $1 FOR UPDATE OF t;`)
 	if err != nil {
 		return 0, err
 	}
 	defer stmt.Close()
 
-	var deposit int
-	var finished bool
-	if err := stmt.QueryRow(ta.TournamentID).Scan(&deposit, &finished); err != nil {
-		return 0, err
+	var deposit, maxAttendees, attendees int
+	var status string
+	err = stmt.QueryRow(ta.TournamentID).Scan(&deposit, &ta.currency, &status, &maxAttendees, &attendees)
+	if err != nil {
+		return 0, notFound(err, CodeTournamentNotFound, "No such tournament")
 	}
 
-	if finished {
-		return 0, errors.New("Cannot join to finished tournament")
+	if status != TournamentAnnounced {
+		return 0, statusError(status, "Cannot join %s tournament", status)
 	}
 
+	ta.full = maxAttendees != 0 && attendees >= maxAttendees
 	return deposit, nil
 }
 
@@ -98,64 +255,136 @@ func (ta *TournamentAttendee) checkUniqAttendee(tx *sql.Tx) error {
 
 	var playerID string
 	if err := stmt.QueryRow(ta.PlayerID, ta.TournamentID).Scan(&playerID); err != sql.ErrNoRows {
-		return errors.New("Cannot join tournament second time")
+		return newError(CodeAlreadyJoined, "Cannot join tournament second time")
+	}
+
+	return nil
+}
+
+func (ta *TournamentAttendee) checkLeaveAllowed(tx *sql.Tx) error {
+	tournament := Tournament{TournamentID: ta.TournamentID}
+	if err := tournament.lockStatus(tx); err != nil {
+		return err
+	}
+
+	if tournament.Status != TournamentAnnounced && tournament.Status != TournamentRegistrationClosed {
+		return statusError(tournament.Status, "Cannot leave %s tournament", tournament.Status)
 	}
 
 	return nil
 }
 
-func (ta *TournamentAttendee) updateAttendeeProfiles(tx *sql.Tx, deposit int) error {
-	playerIDs := preparePostgresArray(append(ta.Backers, ta.PlayerID))
-	stmt, err := tx.Prepare(`SELECT player_id, points FROM players WHERE player_id = ANY($1) FOR UPDATE;`)
+// updateAttendeeProfiles method charges every player his stake, paying it from the balance buckets
+// in the configured order, so the promotional money is spent on tournaments only
+func (ta *TournamentAttendee) updateAttendeeProfiles(tx *sql.Tx) error {
+	ids := ta.playerIDs()
+	playerIDs := preparePostgresArray(ids)
+	stmt, err := tx.Prepare(`SELECT p.player_id, p.status, COALESCE(b.amount, 0) - ` + heldAmount + `,
+                           COALESCE(b.bonus, 0), COALESCE(b.restricted, 0) FROM players AS p
+                           LEFT JOIN player_balances AS b ON b.player_id = p.player_id AND b.currency = $2
+                           WHERE p.player_id = ANY($1) FOR UPDATE OF p;`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(playerIDs)
+	rows, err := stmt.Query(playerIDs, ta.currency)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
-	var players []Player
+	balances := make(map[string]map[string]int)
 	for rows.Next() {
-		var playerID string
-		var points int
+		var playerID, status string
+		var cash, bonus, restricted int
 
-		if err = rows.Scan(&playerID, &points); err != nil {
+		if err = rows.Scan(&playerID, &status, &cash, &bonus, &restricted); err != nil {
 			return err
 		}
 
-		players = append(players, Player{PlayerID: playerID, Points: points})
+		if err = checkPlayerActive(playerID, status); err != nil {
+			return err
+		}
+
+		balances[playerID] = map[string]int{BucketCash: cash, BucketBonus: bonus, BucketRestricted: restricted}
 	}
 
-	if len(players) != len(append(ta.Backers, ta.PlayerID)) {
-		return errors.New("Not every player could be retrieved")
+	if len(balances) != len(ids) {
+		return newError(CodePlayerNotFound, "Not every player could be retrieved")
 	}
 
-	stmt, err = tx.Prepare(`UPDATE players SET points = points - $1 WHERE player_id = ANY($2);`)
-	if err != nil {
-		return err
+	pricesToPay := ta.stakes()
+	payments := make([]map[string]int, len(ids))
+	for i, id := range ids {
+		var enough bool
+		if payments[i], enough = payFromBuckets(balances[id], pricesToPay[i]); !enough {
+			return newError(CodeInsufficientFunds, "Player %s has not enough %s to pay %d", id, ta.currency, pricesToPay[i])
+		}
+
+		// the player who pays nothing still gets the entry, so he is seen in the ledger
+		if len(payments[i]) == 0 {
+			payments[i][BucketCash] = 0
+		}
 	}
-	defer stmt.Close()
 
-	priceToPay := deposit / len(players)
-	if _, err = stmt.Exec(priceToPay, playerIDs); err != nil {
-		return err
+	for i, id := range ids {
+		for _, bucket := range paymentOrder() {
+			amount, ok := payments[i][bucket]
+			if !ok {
+				continue
+			}
+
+			entry := LedgerEntry{
+				PlayerID:     id,
+				TournamentID: ta.TournamentID,
+				AttendeeID:   ta.PlayerID,
+				Type:         EntryDeposit,
+				Currency:     ta.currency,
+				Bucket:       bucket,
+				Amount:       -amount,
+			}
+
+			if err = entry.apply(tx); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
+// playerIDs method returns the player followed by his backers.
+// The player goes first, so he pays or gets the remainder of the division on a tie.
+func (ta *TournamentAttendee) playerIDs() []string {
+	return append([]string{ta.PlayerID}, ta.Backers...)
+}
+
 func (ta *TournamentAttendee) addAttendee(tx *sql.Tx) error {
-	stmt, err := tx.Prepare(`INSERT INTO tournament_attendees (player_id, tournament_id, backers)
-                           VALUES ($1, $2, $3);`)
+	stmt, err := tx.Prepare(`INSERT INTO tournament_attendees (player_id, tournament_id, backers, stake, backer_stakes)
+                           VALUES ($1, $2, $3, $4, $5);`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
 	backers := preparePostgresArray(ta.Backers)
-	if _, err = stmt.Exec(ta.PlayerID, ta.TournamentID, backers); err != nil {
+	backerStakes := preparePostgresIntArray(ta.BackerStakes)
+	if _, err = stmt.Exec(ta.PlayerID, ta.TournamentID, backers, ta.Stake, backerStakes); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func (ta *TournamentAttendee) removeAttendee(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`DELETE FROM tournament_attendees WHERE player_id = $1 AND tournament_id = $2 RETURNING id;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	var id int
+	err = stmt.QueryRow(ta.PlayerID, ta.TournamentID).Scan(&id)
+	return notFound(err, CodeAttendeeNotFound, "No such attendee")
+}
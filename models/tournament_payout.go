@@ -0,0 +1,144 @@
+package models
+
+import (
+	"bidder/util"
+	"database/sql"
+)
+
+// PrizeResult struct holds the winner of the finished tournament with his prize and the payouts made from it.
+// Payouts go to the winner and every his backer, Restricted is the part of the amount won with the bonus.
+type PrizeResult struct {
+	PlayerID string   `json:"playerId"`
+	Position int      `json:"position"`
+	Prize    int      `json:"prize"`
+	Payouts  []Payout `json:"payouts"`
+
+	id int
+}
+
+// Payout struct holds the points credited to one player from the prize
+type Payout struct {
+	PlayerID   string `json:"playerId"`
+	Currency   string `json:"currency"`
+	Amount     int    `json:"amount"`
+	Restricted int    `json:"restricted"`
+}
+
+// FindResults function returns every winner of the tournament with the payouts made to him and his backers.
+// The results are empty until the tournament is finished.
+func FindResults(tournamentID int) ([]PrizeResult, error) {
+	tx, err := util.DBConnect.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = findTournament(tx, tournamentID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	results, err := findResults(tx, tournamentID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = findPayouts(tx, tournamentID, results); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return results, tx.Commit()
+}
+
+// insertResult function stores the winner at the position of the submitted result and returns the result id
+func insertResult(tx *sql.Tx, tournamentID, position int, winner Winner) (int, error) {
+	stmt, err := tx.Prepare(`INSERT INTO tournament_results (tournament_id, player_id, position, prize)
+                           VALUES ($1, $2, $3, $4) RETURNING id;`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var resultID int
+	err = stmt.QueryRow(tournamentID, winner.PlayerID, position, winner.Prize).Scan(&resultID)
+	return resultID, err
+}
+
+// insertPayout function stores the exact points credited to the player from the prize
+func insertPayout(tx *sql.Tx, resultID int, payout Payout) error {
+	stmt, err := tx.Prepare(`INSERT INTO tournament_payouts (result_id, player_id, currency, amount, restricted)
+                           VALUES ($1, $2, $3, $4, $5);`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(resultID, payout.PlayerID, payout.Currency, payout.Amount, payout.Restricted)
+	return err
+}
+
+func findResults(tx *sql.Tx, tournamentID int) ([]PrizeResult, error) {
+	stmt, err := tx.Prepare(`SELECT id, player_id, position, prize FROM tournament_results
+                           WHERE tournament_id = $1 ORDER BY position;`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(tournamentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []PrizeResult{}
+	for rows.Next() {
+		result := PrizeResult{Payouts: []Payout{}}
+		if err = rows.Scan(&result.id, &result.PlayerID, &result.Position, &result.Prize); err != nil {
+			return nil, err
+		}
+
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// findPayouts function fills the payouts of every result in the order they were paid
+func findPayouts(tx *sql.Tx, tournamentID int, results []PrizeResult) error {
+	stmt, err := tx.Prepare(`SELECT po.result_id, po.player_id, po.currency, po.amount, po.restricted
+                           FROM tournament_payouts AS po
+                           JOIN tournament_results AS r ON r.id = po.result_id
+                           WHERE r.tournament_id = $1 ORDER BY po.id;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(tournamentID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byID := make(map[int]*PrizeResult)
+	for i := range results {
+		byID[results[i].id] = &results[i]
+	}
+
+	for rows.Next() {
+		var resultID int
+		var payout Payout
+
+		if err = rows.Scan(&resultID, &payout.PlayerID, &payout.Currency, &payout.Amount, &payout.Restricted); err != nil {
+			return err
+		}
+
+		if result, ok := byID[resultID]; ok {
+			result.Payouts = append(result.Payouts, payout)
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,257 @@
+package models
+
+import (
+	"bidder/util"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+var tournamentStatuses = map[string]bool{
+	TournamentAnnounced:          true,
+	TournamentRegistrationClosed: true,
+	TournamentRunning:            true,
+	TournamentFinished:           true,
+	TournamentCancelled:          true,
+}
+
+// tournamentColumns are read for every found tournament, the collected deposits are taken from the ledger
+const tournamentColumns = `t.id, t.deposit, t.guaranteed_pool, t.currency, t.status,
+  t.name, t.game_type, t.starts_at, t.max_attendees, t.min_attendees,
+  (SELECT COUNT(*) FROM tournament_attendees AS ta WHERE ta.tournament_id = t.id),
+  COALESCE((SELECT -SUM(le.amount) FROM ledger_entries AS le
+            WHERE le.tournament_id = t.id AND le.entry_type IN ('deposit', 'refund')), 0)`
+
+// TournamentsQuery struct holds the filters and pagination of the tournaments list.
+// Cursor is the id of the last tournament of the previous page.
+type TournamentsQuery struct {
+	Statuses []string `form:"status"`
+	Cursor   int      `form:"cursor"`
+	Limit    int      `form:"limit"`
+}
+
+// TournamentsPage struct holds one page of the tournaments list
+type TournamentsPage struct {
+	Tournaments []Tournament `json:"tournaments"`
+	NextCursor  int          `json:"nextCursor,omitempty"`
+}
+
+const (
+	defaultTournamentsLimit = 50
+	maxTournamentsLimit     = 500
+)
+
+// FindTournament function returns the tournament with its attendees count, prize pool and paid prizes
+func FindTournament(tournamentID int) (*Tournament, error) {
+	tx, err := util.DBConnect.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	tournament, err := findTournament(tx, tournamentID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tournament.findResults(tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return tournament, tx.Commit()
+}
+
+// FindAttendees function returns every attendee of the tournament with his backers, in the order they joined
+func FindAttendees(tournamentID int) ([]TournamentAttendee, error) {
+	tx, err := util.DBConnect.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = findTournament(tx, tournamentID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	attendees, err := findAttendees(tx, tournamentID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return attendees, tx.Commit()
+}
+
+// Validate method checks the params before execute actual request
+func (q *TournamentsQuery) Validate() error {
+	for _, status := range q.Statuses {
+		if !tournamentStatuses[status] {
+			return validationError("Unknown tournament status %q!", status)
+		}
+	}
+
+	if q.Cursor < 0 {
+		return validationError("Cursor should be positive number!")
+	}
+
+	if q.Limit < 0 || q.Limit > maxTournamentsLimit {
+		return validationError("Limit should be between 1 and %d!", maxTournamentsLimit)
+	}
+
+	if q.Limit == 0 {
+		q.Limit = defaultTournamentsLimit
+	}
+
+	return nil
+}
+
+// Find method returns the page of the tournaments, newest first
+func (q *TournamentsQuery) Find() (*TournamentsPage, error) {
+	conditions := []string{"TRUE"}
+	args := []interface{}{}
+
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if len(q.Statuses) != 0 {
+		addCondition("t.status = ANY($%d)", preparePostgresArray(q.Statuses))
+	}
+	if q.Cursor != 0 {
+		addCondition("t.id < $%d", q.Cursor)
+	}
+
+	// one extra tournament tells whether there is a next page
+	args = append(args, q.Limit+1)
+	query := fmt.Sprintf(`SELECT %s FROM tournaments AS t WHERE %s ORDER BY t.id DESC LIMIT $%d;`,
+		tournamentColumns, strings.Join(conditions, " AND "), len(args))
+
+	stmt, err := util.DBConnect.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &TournamentsPage{Tournaments: []Tournament{}}
+	for rows.Next() {
+		var tournament Tournament
+		if err = tournament.scan(rows); err != nil {
+			return nil, err
+		}
+
+		page.Tournaments = append(page.Tournaments, tournament)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Tournaments) > q.Limit {
+		page.Tournaments = page.Tournaments[:q.Limit]
+		page.NextCursor = page.Tournaments[q.Limit-1].TournamentID
+	}
+
+	return page, nil
+}
+
+func findTournament(tx *sql.Tx, tournamentID int) (*Tournament, error) {
+	stmt, err := tx.Prepare(`SELECT ` + tournamentColumns + ` FROM tournaments AS t WHERE t.id = $1;`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	tournament := new(Tournament)
+	if err = tournament.scan(stmt.QueryRow(tournamentID)); err != nil {
+		return nil, notFound(err, CodeTournamentNotFound, "No such tournament")
+	}
+
+	return tournament, nil
+}
+
+// scan method reads the tournament columns, the prize pool is never smaller than the guaranteed one
+func (t *Tournament) scan(row interface {
+	Scan(dest ...interface{}) error
+}) error {
+	var collected int
+	err := row.Scan(&t.TournamentID, &t.Deposit, &t.GuaranteedPool, &t.Currency, &t.Status,
+		&t.Name, &t.GameType, &t.StartsAt, &t.MaxAttendees, &t.MinAttendees, &t.AttendeesCount, &collected)
+	if err != nil {
+		return err
+	}
+
+	t.Pool = collected
+	if t.GuaranteedPool > t.Pool {
+		t.Pool = t.GuaranteedPool
+	}
+
+	return nil
+}
+
+// findResults method fills the prize of every winner of the tournament in the submitted order
+func (t *Tournament) findResults(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`SELECT player_id, prize FROM tournament_results WHERE tournament_id = $1 ORDER BY position;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(t.TournamentID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var winner Winner
+		if err = rows.Scan(&winner.PlayerID, &winner.Prize); err != nil {
+			return err
+		}
+
+		t.Results = append(t.Results, winner)
+	}
+
+	return rows.Err()
+}
+
+func findAttendees(tx *sql.Tx, tournamentID int) ([]TournamentAttendee, error) {
+	stmt, err := tx.Prepare(`SELECT player_id, backers, stake, backer_stakes FROM tournament_attendees
+                           WHERE tournament_id = $1 ORDER BY id;`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(tournamentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attendees := []TournamentAttendee{}
+	for rows.Next() {
+		var backers, backerStakes []byte
+		attendee := TournamentAttendee{TournamentID: tournamentID}
+
+		if err = rows.Scan(&attendee.PlayerID, &backers, &attendee.Stake, &backerStakes); err != nil {
+			return nil, err
+		}
+
+		attendee.Backers = parsePostgresArray(string(backers))
+		if attendee.BackerStakes, err = parsePostgresIntArray(string(backerStakes)); err != nil {
+			return nil, err
+		}
+
+		attendees = append(attendees, attendee)
+	}
+
+	return attendees, rows.Err()
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"bidder/util"
+	"database/sql"
+)
+
+// Tournament statuses. Players join the announced tournament, prizes are paid for the running one.
+const (
+	TournamentAnnounced          = "announced"
+	TournamentRegistrationClosed = "registration_closed"
+	TournamentRunning            = "running"
+	TournamentFinished           = "finished"
+	TournamentCancelled          = "cancelled"
+)
+
+// tournamentTransitions holds the statuses every status can be changed to.
+// Finished and cancelled tournaments cannot be changed anymore.
+var tournamentTransitions = map[string][]string{
+	TournamentAnnounced:          {TournamentRegistrationClosed, TournamentRunning, TournamentCancelled},
+	TournamentRegistrationClosed: {TournamentAnnounced, TournamentRunning, TournamentCancelled},
+	TournamentRunning:            {TournamentFinished, TournamentCancelled},
+}
+
+// ChangeStatus method moves the tournament to the new status if the transition is allowed
+func (t *Tournament) ChangeStatus(status string) error {
+	tx, err := util.DBConnect.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = t.lockStatus(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = checkTransition(t.Status, status); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = setTournamentStatus(tx, t.TournamentID, status); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	t.Status = status
+	return tx.Commit()
+}
+
+// Cancel method cancels the tournament and refunds every player and backer
+// exactly the deposit he was charged for it
+func (t *Tournament) Cancel() error {
+	tx, err := util.DBConnect.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = t.lockStatus(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = checkTransition(t.Status, TournamentCancelled); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = t.cancel(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// cancel method refunds the deposits and marks the locked tournament as cancelled
+func (t *Tournament) cancel(tx *sql.Tx) error {
+	if err := refundDeposits(tx, t.TournamentID, ""); err != nil {
+		return err
+	}
+
+	if err := setTournamentStatus(tx, t.TournamentID, TournamentCancelled); err != nil {
+		return err
+	}
+
+	t.Status = TournamentCancelled
+	return nil
+}
+
+// lockStatus method reads the tournament status and locks the tournament till the end of transaction
+func (t *Tournament) lockStatus(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`SELECT status FROM tournaments WHERE id = $1 FOR UPDATE;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	err = stmt.QueryRow(t.TournamentID).Scan(&t.Status)
+	return notFound(err, CodeTournamentNotFound, "No such tournament")
+}
+
+// checkTransition function returns an error if the tournament cannot be moved from one status to another
+func checkTransition(from, to string) error {
+	for _, status := range tournamentTransitions[from] {
+		if status == to {
+			return nil
+		}
+	}
+
+	return statusError(from, "Cannot move %s tournament to %s status", from, to)
+}
+
+// statusError function returns the error of the action not allowed for the tournament in the given status
+func statusError(status, format string, args ...interface{}) error {
+	switch status {
+	case TournamentFinished:
+		return newError(CodeTournamentFinished, format, args...)
+	case TournamentCancelled:
+		return newError(CodeTournamentCancelled, format, args...)
+	default:
+		return newError(CodeInvalidTournamentStatus, format, args...)
+	}
+}
+
+// setTournamentStatus function changes the status of the tournament.
+// The waitlist is dropped once the tournament is not announced anymore, as nobody is promoted then.
+func setTournamentStatus(tx *sql.Tx, tournamentID int, status string) error {
+	stmt, err := tx.Prepare(`UPDATE tournaments SET status = $1 WHERE id = $2;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err = stmt.Exec(status, tournamentID); err != nil {
+		return err
+	}
+
+	if status == TournamentAnnounced {
+		return nil
+	}
+
+	return clearWaitlist(tx, tournamentID)
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// joinWaitlist method puts the attendee on the waitlist of the full tournament, if he asked for it.
+// Nothing is charged until the attendee is promoted.
+func (ta *TournamentAttendee) joinWaitlist(tx *sql.Tx) error {
+	if !ta.Waitlist {
+		return newError(CodeTournamentFull, "Tournament %d is full", ta.TournamentID)
+	}
+
+	if err := checkPlayersActive(tx, ta.playerIDs()); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO tournament_waitlist (tournament_id, player_id, backers, backer_shares, percents)
+                           VALUES ($1, $2, $3, $4, $5);`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	backers := preparePostgresArray(ta.Backers)
+	backerShares := preparePostgresIntArray(ta.backerShares)
+	if _, err = stmt.Exec(ta.TournamentID, ta.PlayerID, backers, backerShares, ta.percents); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return newError(CodeAlreadyJoined, "Cannot join tournament second time")
+		}
+
+		return err
+	}
+
+	ta.Waitlisted = true
+	return nil
+}
+
+// checkNotWaitlisted method makes sure the attendee is not waiting for the seat already
+func (ta *TournamentAttendee) checkNotWaitlisted(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`SELECT id FROM tournament_waitlist WHERE tournament_id = $1 AND player_id = $2;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	var id int
+	if err = stmt.QueryRow(ta.TournamentID, ta.PlayerID).Scan(&id); err != sql.ErrNoRows {
+		if err != nil {
+			return err
+		}
+
+		return newError(CodeAlreadyJoined, "Cannot join tournament second time")
+	}
+
+	return nil
+}
+
+// leaveWaitlist method removes the attendee from the waitlist and tells whether he was there
+func (ta *TournamentAttendee) leaveWaitlist(tx *sql.Tx) (bool, error) {
+	stmt, err := tx.Prepare(`DELETE FROM tournament_waitlist WHERE tournament_id = $1 AND player_id = $2;`)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.Exec(ta.TournamentID, ta.PlayerID)
+	if err != nil {
+		return false, err
+	}
+
+	removed, err := res.RowsAffected()
+	return removed != 0, err
+}
+
+// promoteWaitlisted function gives the free seats of the announced tournament to the waitlisted attendees in the order
+// they joined the waitlist, charging their deposits. The attendee who is not able to pay is dropped from the waitlist.
+// Nobody is promoted once the registration is closed. The tournament should be locked by the caller.
+func promoteWaitlisted(tx *sql.Tx, tournamentID int) error {
+	var deposit, maxAttendees, attendees int
+	var currency, status string
+
+	err := tx.QueryRow(`SELECT t.deposit, t.currency, t.status, t.max_attendees,
+                      (SELECT COUNT(*) FROM tournament_attendees AS ta WHERE ta.tournament_id = t.id)
+                      FROM tournaments AS t WHERE t.id = $1;`, tournamentID).Scan(&deposit, &currency, &status, &maxAttendees, &attendees)
+	if err != nil {
+		return err
+	}
+
+	if status != TournamentAnnounced {
+		return nil
+	}
+
+	for maxAttendees == 0 || attendees < maxAttendees {
+		attendee, err := popWaitlisted(tx, tournamentID)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		attendee.currency = currency
+		promoted, err := attendee.promote(tx, deposit)
+		if err != nil {
+			return err
+		}
+
+		if promoted {
+			attendees++
+		}
+	}
+
+	return nil
+}
+
+// popWaitlisted function removes the first attendee from the waitlist and returns him
+func popWaitlisted(tx *sql.Tx, tournamentID int) (*TournamentAttendee, error) {
+	stmt, err := tx.Prepare(`DELETE FROM tournament_waitlist WHERE id = (
+                             SELECT id FROM tournament_waitlist WHERE tournament_id = $1 ORDER BY id LIMIT 1 FOR UPDATE
+                           ) RETURNING player_id, backers, backer_shares, percents;`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var backers, backerShares []byte
+	attendee := &TournamentAttendee{TournamentID: tournamentID}
+
+	err = stmt.QueryRow(tournamentID).Scan(&attendee.PlayerID, &backers, &backerShares, &attendee.percents)
+	if err != nil {
+		return nil, err
+	}
+
+	attendee.Backers = parsePostgresArray(string(backers))
+	if attendee.backerShares, err = parsePostgresIntArray(string(backerShares)); err != nil {
+		return nil, err
+	}
+
+	return attendee, nil
+}
+
+// promote method charges the deposit of the waitlisted attendee and adds him to the tournament within the savepoint,
+// so the attendee who is not able to pay is skipped without the promotions made before
+func (ta *TournamentAttendee) promote(tx *sql.Tx, deposit int) (bool, error) {
+	if _, err := tx.Exec(`SAVEPOINT waitlist_promotion;`); err != nil {
+		return false, err
+	}
+
+	err := ta.resolveStakes(deposit)
+	if err == nil {
+		err = ta.updateAttendeeProfiles(tx)
+	}
+	if err == nil {
+		err = ta.addAttendee(tx)
+	}
+
+	if err == nil {
+		_, err = tx.Exec(`RELEASE SAVEPOINT waitlist_promotion;`)
+		return err == nil, err
+	}
+
+	if _, ok := err.(*Error); !ok {
+		return false, err
+	}
+
+	log.Printf("Waitlisted player %s is not promoted to tournament %d: %s", ta.PlayerID, ta.TournamentID, err)
+	_, err = tx.Exec(`ROLLBACK TO SAVEPOINT waitlist_promotion;`)
+	return false, err
+}
+
+// clearWaitlist function removes every waitlisted attendee of the tournament,
+// it is called once the tournament is not announced anymore
+func clearWaitlist(tx *sql.Tx, tournamentID int) error {
+	stmt, err := tx.Prepare(`DELETE FROM tournament_waitlist WHERE tournament_id = $1;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(tournamentID)
+	return err
+}
+
+// checkPlayersActive function makes sure every player is registered and active
+func checkPlayersActive(tx *sql.Tx, playerIDs []string) error {
+	stmt, err := tx.Prepare(`SELECT player_id, status FROM players WHERE player_id = ANY($1);`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(preparePostgresArray(playerIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := 0
+	for rows.Next() {
+		var playerID, status string
+		if err = rows.Scan(&playerID, &status); err != nil {
+			return err
+		}
+
+		if err = checkPlayerActive(playerID, status); err != nil {
+			return err
+		}
+		found++
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if found != len(playerIDs) {
+		return newError(CodePlayerNotFound, "Not every player could be retrieved")
+	}
+
+	return nil
+}
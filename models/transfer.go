@@ -0,0 +1,126 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Transfer struct holds the points moved from one player to another.
+// Only the available withdrawable points are transferred.
+type Transfer struct {
+	ID           int       `json:"id"`
+	FromPlayerID string    `json:"fromPlayerId"`
+	ToPlayerID   string    `json:"toPlayerId"`
+	Currency     string    `json:"currency"`
+	Amount       int       `json:"amount"`
+	Reference    string    `json:"reference"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Validate method checks the params before execute actual request
+func (t *Transfer) Validate() error {
+	var invalidFields fieldErrors
+
+	if len(t.FromPlayerID) == 0 {
+		invalidFields.add("fromPlayerId", "Sender should not be empty")
+	}
+
+	if len(t.ToPlayerID) == 0 {
+		invalidFields.add("toPlayerId", "Receiver should not be empty")
+	} else if t.ToPlayerID == t.FromPlayerID {
+		invalidFields.add("toPlayerId", "Receiver should differ from the sender")
+	}
+
+	if t.Amount <= 0 {
+		invalidFields.add("amount", "Amount should be positive number")
+	}
+
+	if len(t.Reference) > 256 {
+		invalidFields.add("reference", "Reference should not be longer than 256 characters")
+	}
+
+	if err := invalidFields.toError(CodeValidationFailed, "Transfer is invalid"); err != nil {
+		return err
+	}
+
+	return validateCurrency(&t.Currency)
+}
+
+// Execute method takes the points from the sender and gives them to the receiver in one transaction.
+// Both players are locked in the order of their ids, so the opposite transfers never deadlock.
+func (t *Transfer) Execute(key *IdempotencyKey) error {
+	tx, err := key.begin()
+	if err != nil {
+		return err
+	}
+
+	if err = lockPlayers(tx, []string{t.FromPlayerID, t.ToPlayerID}); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	if err = t.checkPlayers(tx); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	if err = t.insert(tx); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	if err = t.moveAmount(tx); err != nil {
+		key.rollback(tx)
+		return err
+	}
+
+	return key.commit(tx)
+}
+
+// checkPlayers method makes sure both players are active and the sender has enough available points
+func (t *Transfer) checkPlayers(tx *sql.Tx) error {
+	status, available, err := lockBalance(tx, t.FromPlayerID, t.Currency)
+	if err != nil {
+		return err
+	}
+
+	if err = checkPlayerActive(t.FromPlayerID, status); err != nil {
+		return err
+	}
+
+	if available < t.Amount {
+		return newError(CodeInsufficientFunds, "Player %s has only %d %s available", t.FromPlayerID, available, t.Currency)
+	}
+
+	if status, _, err = lockBalance(tx, t.ToPlayerID, t.Currency); err != nil {
+		return err
+	}
+
+	return checkPlayerActive(t.ToPlayerID, status)
+}
+
+func (t *Transfer) insert(tx *sql.Tx) error {
+	stmt, err := tx.Prepare(`INSERT INTO transfers (from_player_id, to_player_id, currency, amount, reference)
+                           VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	return stmt.QueryRow(t.FromPlayerID, t.ToPlayerID, t.Currency, t.Amount, t.Reference).Scan(&t.ID, &t.CreatedAt)
+}
+
+func (t *Transfer) moveAmount(tx *sql.Tx) error {
+	entries := []LedgerEntry{
+		{PlayerID: t.FromPlayerID, TransferID: t.ID, Type: EntryTransfer, Currency: t.Currency, Amount: -t.Amount},
+		{PlayerID: t.ToPlayerID, TransferID: t.ID, Type: EntryTransfer, Currency: t.Currency, Amount: t.Amount},
+	}
+
+	for i := range entries {
+		if err := entries[i].apply(tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
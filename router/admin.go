@@ -0,0 +1,43 @@
+package router
+
+import (
+	"bidder/models"
+	"bidder/util"
+	"crypto/subtle"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+const adminTokenHeader = "X-Admin-Token"
+
+// resetGuard middleware lets the reset request through only if the reset is enabled
+// and the request has the admin token. Every attempt is written to the audit log.
+func resetGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !util.ResetAllowed() {
+			log.Printf("AUDIT: rejected DataBase reset from %s: reset is disabled", c.ClientIP())
+			abortWithError(c, &models.Error{Code: models.CodeResetDisabled, Message: "DataBase reset is disabled"})
+			return
+		}
+
+		if !validAdminToken(c.Request.Header.Get(adminTokenHeader)) {
+			log.Printf("AUDIT: rejected DataBase reset from %s: invalid admin token", c.ClientIP())
+			abortWithError(c, &models.Error{Code: models.CodeUnauthorized, Message: "Admin token is required"})
+			return
+		}
+
+		c.Next()
+
+		log.Printf("AUDIT: DataBase reset from %s finished with %d status", c.ClientIP(), c.Writer.Status())
+	}
+}
+
+func validAdminToken(token string) bool {
+	adminToken := util.AdminToken()
+	if len(adminToken) == 0 {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
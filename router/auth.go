@@ -0,0 +1,59 @@
+package router
+
+import (
+	"bidder/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// apiKeyContextKey is the name the authorized API key is kept in the request context under
+const apiKeyContextKey = "apiKey"
+
+// Roles allowed to call every group of routes. Admin keys are allowed everywhere.
+var (
+	readers   = []string{models.RoleReader, models.RoleCashier, models.RoleOperator}
+	cashiers  = []string{models.RoleCashier}
+	operators = []string{models.RoleOperator}
+)
+
+// authorize middleware lets the request through only if it has the active API key with one of the roles.
+// The key is passed in X-API-Key header or as the bearer token of Authorization header.
+func authorize(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Request.Header.Get(apiKeyHeader)
+		if len(key) == 0 {
+			key = strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		}
+
+		if len(key) == 0 {
+			abortWithError(c, &models.Error{Code: models.CodeUnauthorized, Message: "API key is required"})
+			return
+		}
+
+		apiKey, err := models.FindAPIKey(key)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		if !apiKey.Allows(roles...) {
+			abortWithError(c, &models.Error{Code: models.CodeForbidden, Message: "API key role is not allowed to do this"})
+			return
+		}
+
+		c.Set(apiKeyContextKey, apiKey)
+		c.Next()
+	}
+}
+
+// authorizedKey function returns the API key the request is authorized with, or nil if it is not authorized
+func authorizedKey(c *gin.Context) *models.APIKey {
+	if apiKey, ok := c.Get(apiKeyContextKey); ok {
+		return apiKey.(*models.APIKey)
+	}
+
+	return nil
+}
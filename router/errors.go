@@ -0,0 +1,69 @@
+package router
+
+import (
+	"bidder/models"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errorStatuses maps every error code of the application to the HTTP status
+var errorStatuses = map[string]int{
+	models.CodeValidationFailed:         http.StatusBadRequest,
+	models.CodeInvalidWinners:           http.StatusUnprocessableEntity,
+	models.CodePrizePoolExceeded:        http.StatusUnprocessableEntity,
+	models.CodePlayerNotFound:           http.StatusNotFound,
+	models.CodePlayerExists:             http.StatusBadRequest,
+	models.CodePlayerNotActive:          http.StatusForbidden,
+	models.CodePlayerHasFunds:           http.StatusBadRequest,
+	models.CodeTournamentNotFound:       http.StatusNotFound,
+	models.CodeAttendeeNotFound:         http.StatusNotFound,
+	models.CodeInsufficientFunds:        http.StatusBadRequest,
+	models.CodeTournamentExists:         http.StatusBadRequest,
+	models.CodeTournamentFinished:       http.StatusBadRequest,
+	models.CodeTournamentCancelled:      http.StatusBadRequest,
+	models.CodeInvalidTournamentStatus:  http.StatusBadRequest,
+	models.CodeAlreadyJoined:            http.StatusBadRequest,
+	models.CodeTournamentFull:           http.StatusBadRequest,
+	models.CodeHoldNotFound:             http.StatusNotFound,
+	models.CodeHoldNotActive:            http.StatusBadRequest,
+	models.CodeIdempotencyKeyReused:     http.StatusUnprocessableEntity,
+	models.CodeIdempotencyKeyInProgress: http.StatusConflict,
+	models.CodeUnauthorized:             http.StatusUnauthorized,
+	models.CodeForbidden:                http.StatusForbidden,
+	models.CodeInvalidSignature:         http.StatusUnauthorized,
+	models.CodeAPIKeyNotFound:           http.StatusNotFound,
+	models.CodeResetDisabled:            http.StatusForbidden,
+	models.CodeInternal:                 http.StatusInternalServerError,
+}
+
+// errorResponse function returns the HTTP status and the stable JSON envelope for any error.
+// Errors which are not the domain ones (database failures and so on) are logged and hidden from the client.
+func errorResponse(err error) (int, gin.H) {
+	domainError, ok := err.(*models.Error)
+	if !ok {
+		log.Printf("Unexpected error: %s", err)
+		domainError = &models.Error{Code: models.CodeInternal, Message: "Internal server error"}
+	}
+
+	status, ok := errorStatuses[domainError.Code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+
+	return status, gin.H{"error": domainError}
+}
+
+func respondWithError(c *gin.Context, err error) {
+	c.JSON(errorResponse(err))
+}
+
+func abortWithError(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(errorResponse(err))
+}
+
+// bindingError function wraps the error of the request parsing into the validation error
+func bindingError(err error) error {
+	return &models.Error{Code: models.CodeValidationFailed, Message: err.Error()}
+}
@@ -2,8 +2,8 @@ package router
 
 import (
 	"bidder/models"
-	"database/sql"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,19 +12,19 @@ func fundHandler(c *gin.Context) {
 	var player models.Player
 
 	if err := c.Bind(&player); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"validationError": err.Error()})
+		respondWithError(c, bindingError(err))
 		return
 	}
 
 	if err := player.Validate(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"validationError": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 
-	if err := player.Fund(); err == nil {
+	if err := player.FundCreating(reservedKey(c)); err == nil {
 		c.JSON(http.StatusOK, gin.H{"Result": "Player funded succesfully"})
 	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"badRequest": err.Error()})
+		respondWithError(c, err)
 	}
 }
 
@@ -32,23 +32,19 @@ func takeHandler(c *gin.Context) {
 	var player models.Player
 
 	if err := c.Bind(&player); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"validationError": err.Error()})
+		respondWithError(c, bindingError(err))
 		return
 	}
 
 	if err := player.Validate(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"validationError": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 
-	if err := player.Take(); err == nil {
+	if err := player.Take(reservedKey(c)); err == nil {
 		c.JSON(http.StatusOK, gin.H{"Result": "Player's points were taken succesfully"})
 	} else {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"notFoundError": "No such player"})
-		} else {
-			c.JSON(http.StatusBadRequest, gin.H{"badRequest": err.Error()})
-		}
+		respondWithError(c, err)
 	}
 }
 
@@ -56,19 +52,25 @@ func announceTournamentHandler(c *gin.Context) {
 	var tournament models.Tournament
 
 	if err := c.Bind(&tournament); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"validationError": err.Error()})
+		respondWithError(c, bindingError(err))
+		return
+	}
+
+	// the legacy clients never get the allocated id back, so they should pass their own
+	if tournament.TournamentID == 0 {
+		respondWithError(c, &models.Error{Code: models.CodeValidationFailed, Message: "TournamentID should be positive number!"})
 		return
 	}
 
 	if err := tournament.Validate(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"validationError": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 
-	if err := tournament.Announce(); err == nil {
+	if err := tournament.Announce(reservedKey(c)); err == nil {
 		c.JSON(http.StatusOK, gin.H{"Result": "Tournament announced succesfully"})
 	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"badRequest": err.Error()})
+		respondWithError(c, err)
 	}
 }
 
@@ -76,23 +78,21 @@ func joinTournamentHandler(c *gin.Context) {
 	var attendee models.TournamentAttendee
 
 	if err := c.Bind(&attendee); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"validationError": err.Error()})
+		respondWithError(c, bindingError(err))
 		return
 	}
 
 	if err := attendee.Validate(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"validationError": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 
-	if err := attendee.JoinTournament(); err == nil {
-		c.JSON(http.StatusOK, gin.H{"Result": "Attendee joined succesfully"})
+	if err := attendee.JoinTournament(reservedKey(c)); err != nil {
+		respondWithError(c, err)
+	} else if attendee.Waitlisted {
+		c.JSON(http.StatusOK, gin.H{"Result": "Attendee is waitlisted"})
 	} else {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"notFoundError": err.Error()})
-		} else {
-			c.JSON(http.StatusBadRequest, gin.H{"badRequest": err.Error()})
-		}
+		c.JSON(http.StatusOK, gin.H{"Result": "Attendee joined succesfully"})
 	}
 }
 
@@ -100,33 +100,104 @@ func resultTournamentHandler(c *gin.Context) {
 	var result models.TournamentResult
 
 	if err := c.BindJSON(&result); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"validationError": err.Error()})
+		respondWithError(c, bindingError(err))
 		return
 	}
 
 	if err := result.Validate(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"validationError": err.Error()})
+		respondWithError(c, err)
 		return
 	}
 
-	if err := result.Finish(); err == nil {
+	result.Signature = partnerSignature(c)
+	if err := result.Finish(reservedKey(c)); err == nil {
 		c.JSON(http.StatusOK, gin.H{"Result": "Tournament finished succesfully"})
 	} else {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"notFoundError": err.Error()})
+		respondWithError(c, err)
+	}
+}
+
+// tournamentStatusHandler returns the handler which moves the tournament to the given status
+func tournamentStatusHandler(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tournamentID, err := tournamentIDParam(c)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+
+		tournament := models.Tournament{TournamentID: tournamentID}
+		if err := tournament.ChangeStatus(status); err == nil {
+			c.JSON(http.StatusOK, tournament)
 		} else {
-			c.JSON(http.StatusBadRequest, gin.H{"badRequest": err.Error()})
+			respondWithError(c, err)
 		}
 	}
 }
 
+func cancelTournamentHandler(c *gin.Context) {
+	tournamentID, err := tournamentIDParam(c)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	tournament := models.Tournament{TournamentID: tournamentID}
+	if err := tournament.Cancel(); err == nil {
+		c.JSON(http.StatusOK, gin.H{"Result": "Tournament cancelled succesfully"})
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func leaveTournamentHandler(c *gin.Context) {
+	tournamentID, err := tournamentIDParam(c)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	attendee := models.TournamentAttendee{TournamentID: tournamentID, PlayerID: c.Query("playerId")}
+	if err := attendee.Validate(); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if err := attendee.LeaveTournament(); err == nil {
+		c.JSON(http.StatusOK, gin.H{"Result": "Attendee left succesfully"})
+	} else {
+		respondWithError(c, err)
+	}
+}
+
 func balanceHandler(c *gin.Context) {
 	playerID := c.Query("playerId")
 
-	if player, err := models.FindPlayer(playerID); err == nil {
+	if player, err := models.FindPlayer(reservedKey(c), playerID); err == nil {
 		c.JSON(http.StatusOK, player)
 	} else {
-		c.JSON(http.StatusNotFound, gin.H{"notFoundError": "No such player"})
+		respondWithError(c, err)
+	}
+}
+
+func transactionsHandler(c *gin.Context) {
+	var query models.TransactionsQuery
+
+	if err := c.Bind(&query); err != nil {
+		respondWithError(c, bindingError(err))
+		return
+	}
+
+	query.PlayerID = c.Param("id")
+	if err := query.Validate(); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if page, err := query.Find(); err == nil {
+		c.JSON(http.StatusOK, page)
+	} else {
+		respondWithError(c, err)
 	}
 }
 
@@ -134,6 +205,16 @@ func resetHandler(c *gin.Context) {
 	if err := models.ResetDB(); err == nil {
 		c.JSON(http.StatusOK, gin.H{"Result": "DataBase is in clean state now"})
 	} else {
-		c.JSON(http.StatusInternalServerError, gin.H{"internalError": err.Error()})
+		respondWithError(c, err)
 	}
 }
+
+// tournamentIDParam function returns the tournament id passed in the path
+func tournamentIDParam(c *gin.Context) (int, error) {
+	tournamentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || tournamentID <= 0 {
+		return 0, &models.Error{Code: models.CodeValidationFailed, Message: "TournamentID should be positive number!"}
+	}
+
+	return tournamentID, nil
+}
@@ -0,0 +1,478 @@
+package router
+
+import (
+	"bidder/models"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// playerRequest struct holds the JSON body of the register player request
+type playerRequest struct {
+	PlayerID    string `json:"playerId" binding:"required"`
+	DisplayName string `json:"displayName"`
+	Currency    string `json:"currency"`
+	Region      string `json:"region"`
+}
+
+// pointsRequest struct holds the JSON body of the fund and take requests.
+// Points are moved in the default currency and the cash bucket if none of them is passed.
+type pointsRequest struct {
+	Points   int    `json:"points" binding:"required"`
+	Currency string `json:"currency"`
+	Bucket   string `json:"bucket"`
+}
+
+// batchRequest struct holds the JSON body of the players batch request
+type batchRequest struct {
+	Mode       string                  `json:"mode"`
+	Operations []models.BatchOperation `json:"operations" binding:"required"`
+}
+
+// transferRequest struct holds the JSON body of the transfer request
+type transferRequest struct {
+	FromPlayerID string `json:"fromPlayerId" binding:"required"`
+	ToPlayerID   string `json:"toPlayerId" binding:"required"`
+	Amount       int    `json:"amount" binding:"required"`
+	Currency     string `json:"currency"`
+	Reference    string `json:"reference"`
+}
+
+// holdRequest struct holds the JSON body of the place hold request. ExpiresIn is in seconds.
+type holdRequest struct {
+	Amount    int    `json:"amount" binding:"required"`
+	Currency  string `json:"currency"`
+	Reason    string `json:"reason"`
+	ExpiresIn int    `json:"expiresIn"`
+}
+
+// attendeeRequest struct holds the JSON body of the join tournament request.
+// Every backer has either the stake in points or in percents of the deposit, or none of them.
+// Waitlist puts the player on the waitlist if the tournament is full.
+type attendeeRequest struct {
+	PlayerID string          `json:"playerId" binding:"required"`
+	Backers  []backerRequest `json:"backers"`
+	Waitlist bool            `json:"waitlist"`
+}
+
+type backerRequest struct {
+	PlayerID string `json:"playerId" binding:"required"`
+	Stake    int    `json:"stake"`
+	Percent  int    `json:"percent"`
+}
+
+// resultRequest struct holds the JSON body of the tournament result request
+type resultRequest struct {
+	Winners []models.Winner `json:"winners" binding:"required"`
+}
+
+func registerPlayerHandler(c *gin.Context) {
+	var request playerRequest
+
+	if err := c.BindJSON(&request); err != nil {
+		respondWithError(c, bindingError(err))
+		return
+	}
+
+	player := models.Player{
+		PlayerID:    request.PlayerID,
+		DisplayName: request.DisplayName,
+		Currency:    request.Currency,
+		Region:      request.Region,
+	}
+	if err := player.ValidateProfile(); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if err := player.Register(); err == nil {
+		c.JSON(http.StatusCreated, player)
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func updatePlayerHandler(c *gin.Context) {
+	var update models.ProfileUpdate
+
+	if err := c.BindJSON(&update); err != nil {
+		respondWithError(c, bindingError(err))
+		return
+	}
+
+	player := models.Player{PlayerID: c.Param("id")}
+	if err := player.UpdateProfile(update); err == nil {
+		c.JSON(http.StatusOK, player)
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func closePlayerHandler(c *gin.Context) {
+	closed := models.PlayerClosed
+
+	player := models.Player{PlayerID: c.Param("id")}
+	if err := player.UpdateProfile(models.ProfileUpdate{Status: &closed}); err == nil {
+		c.JSON(http.StatusOK, player)
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func fundPlayerHandler(c *gin.Context) {
+	var request pointsRequest
+
+	if err := c.BindJSON(&request); err != nil {
+		respondWithError(c, bindingError(err))
+		return
+	}
+
+	player := models.Player{
+		PlayerID:        c.Param("id"),
+		Points:          request.Points,
+		BalanceCurrency: request.Currency,
+		Bucket:          request.Bucket,
+	}
+	if err := player.Validate(); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if err := player.Fund(reservedKey(c)); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	playerBalanceHandler(c)
+}
+
+func takePlayerHandler(c *gin.Context) {
+	var request pointsRequest
+
+	if err := c.BindJSON(&request); err != nil {
+		respondWithError(c, bindingError(err))
+		return
+	}
+
+	player := models.Player{
+		PlayerID:        c.Param("id"),
+		Points:          request.Points,
+		BalanceCurrency: request.Currency,
+		Bucket:          request.Bucket,
+	}
+	if err := player.Validate(); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if err := player.Take(reservedKey(c)); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	playerBalanceHandler(c)
+}
+
+func playerBalanceHandler(c *gin.Context) {
+	if player, err := models.FindPlayer(reservedKey(c), c.Param("id")); err == nil {
+		c.JSON(http.StatusOK, player)
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func playersBatchHandler(c *gin.Context) {
+	var request batchRequest
+
+	if err := c.BindJSON(&request); err != nil {
+		respondWithError(c, bindingError(err))
+		return
+	}
+
+	batch := models.PlayersBatch{Mode: request.Mode, Operations: request.Operations}
+	if err := batch.Validate(); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if err := batch.Apply(reservedKey(c)); err == nil {
+		c.JSON(http.StatusOK, batch)
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func transferHandler(c *gin.Context) {
+	var request transferRequest
+
+	if err := c.BindJSON(&request); err != nil {
+		respondWithError(c, bindingError(err))
+		return
+	}
+
+	transfer := models.Transfer{
+		FromPlayerID: request.FromPlayerID,
+		ToPlayerID:   request.ToPlayerID,
+		Currency:     request.Currency,
+		Amount:       request.Amount,
+		Reference:    request.Reference,
+	}
+	if err := transfer.Validate(); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if err := transfer.Execute(reservedKey(c)); err == nil {
+		c.JSON(http.StatusCreated, transfer)
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func placeHoldHandler(c *gin.Context) {
+	var request holdRequest
+
+	if err := c.BindJSON(&request); err != nil {
+		respondWithError(c, bindingError(err))
+		return
+	}
+
+	hold := models.Hold{
+		PlayerID:  c.Param("id"),
+		Currency:  request.Currency,
+		Amount:    request.Amount,
+		Reason:    request.Reason,
+		ExpiresIn: request.ExpiresIn,
+	}
+	if err := hold.Validate(); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if err := hold.Place(reservedKey(c)); err == nil {
+		c.JSON(http.StatusCreated, hold)
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func holdHandler(c *gin.Context) {
+	holdID, err := holdIDParam(c)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if hold, err := models.FindHold(holdID); err == nil {
+		c.JSON(http.StatusOK, hold)
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func captureHoldHandler(c *gin.Context) {
+	holdID, err := holdIDParam(c)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	hold := models.Hold{ID: holdID}
+	if err := hold.Capture(reservedKey(c)); err == nil {
+		c.JSON(http.StatusOK, hold)
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func releaseHoldHandler(c *gin.Context) {
+	holdID, err := holdIDParam(c)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	hold := models.Hold{ID: holdID}
+	if err := hold.Release(reservedKey(c)); err == nil {
+		c.JSON(http.StatusOK, hold)
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func createTournamentHandler(c *gin.Context) {
+	var tournament models.Tournament
+
+	if err := c.BindJSON(&tournament); err != nil {
+		respondWithError(c, bindingError(err))
+		return
+	}
+
+	if err := tournament.Validate(); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if err := tournament.Announce(reservedKey(c)); err == nil {
+		c.JSON(http.StatusCreated, tournament)
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func tournamentHandler(c *gin.Context) {
+	tournamentID, err := tournamentIDParam(c)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if tournament, err := models.FindTournament(tournamentID); err == nil {
+		c.JSON(http.StatusOK, tournament)
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func tournamentsHandler(c *gin.Context) {
+	var query models.TournamentsQuery
+
+	if err := c.Bind(&query); err != nil {
+		respondWithError(c, bindingError(err))
+		return
+	}
+
+	if err := query.Validate(); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if page, err := query.Find(); err == nil {
+		c.JSON(http.StatusOK, page)
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func tournamentAttendeesHandler(c *gin.Context) {
+	tournamentID, err := tournamentIDParam(c)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if attendees, err := models.FindAttendees(tournamentID); err == nil {
+		c.JSON(http.StatusOK, gin.H{"attendees": attendees})
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func tournamentResultsHandler(c *gin.Context) {
+	tournamentID, err := tournamentIDParam(c)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if results, err := models.FindResults(tournamentID); err == nil {
+		c.JSON(http.StatusOK, gin.H{"results": results})
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func addAttendeeHandler(c *gin.Context) {
+	tournamentID, err := tournamentIDParam(c)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	var request attendeeRequest
+	if err := c.BindJSON(&request); err != nil {
+		respondWithError(c, bindingError(err))
+		return
+	}
+
+	attendee := models.TournamentAttendee{TournamentID: tournamentID, PlayerID: request.PlayerID, Waitlist: request.Waitlist}
+	for _, backer := range request.Backers {
+		attendee.Backers = append(attendee.Backers, backer.spec())
+	}
+
+	if err := attendee.Validate(); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if err := attendee.JoinTournament(reservedKey(c)); err == nil {
+		c.JSON(http.StatusCreated, attendee)
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func removeAttendeeHandler(c *gin.Context) {
+	tournamentID, err := tournamentIDParam(c)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	attendee := models.TournamentAttendee{TournamentID: tournamentID, PlayerID: c.Param("playerId")}
+	if err := attendee.Validate(); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if err := attendee.LeaveTournament(); err == nil {
+		c.Status(http.StatusNoContent)
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+func tournamentResultHandler(c *gin.Context) {
+	var request resultRequest
+
+	if err := c.BindJSON(&request); err != nil {
+		respondWithError(c, bindingError(err))
+		return
+	}
+
+	result := models.TournamentResult{TournamentID: c.Param("id"), Winners: request.Winners, Signature: partnerSignature(c)}
+	if err := result.Validate(); err != nil {
+		respondWithError(c, err)
+		return
+	}
+
+	if err := result.Finish(reservedKey(c)); err == nil {
+		c.JSON(http.StatusOK, gin.H{"Result": "Tournament finished succesfully"})
+	} else {
+		respondWithError(c, err)
+	}
+}
+
+// holdIDParam function returns the hold id passed in the path
+func holdIDParam(c *gin.Context) (int, error) {
+	holdID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || holdID <= 0 {
+		return 0, &models.Error{Code: models.CodeValidationFailed, Message: "HoldID should be positive number!"}
+	}
+
+	return holdID, nil
+}
+
+// spec method returns the backer in the form accepted by the legacy joinTournament endpoint
+func (b backerRequest) spec() string {
+	switch {
+	case b.Percent != 0:
+		return fmt.Sprintf("%s:%d%%", b.PlayerID, b.Percent)
+	case b.Stake != 0:
+		return fmt.Sprintf("%s:%d", b.PlayerID, b.Stake)
+	default:
+		return b.PlayerID
+	}
+}
@@ -0,0 +1,152 @@
+package router
+
+import (
+	"bidder/models"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyParam      = "requestId"
+	idempotencyKeyContextKey = "idempotencyKey"
+)
+
+// responseRecorder holds the response body back until it is stored with the idempotency key,
+// so the client never gets the response which could not be replayed
+type responseRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	return r.body.Write(data)
+}
+
+func (r *responseRecorder) WriteString(data string) (int, error) {
+	return r.body.WriteString(data)
+}
+
+// flush method sends the recorded response to the client
+func (r *responseRecorder) flush() {
+	r.ResponseWriter.WriteHeaderNow()
+	if _, err := r.ResponseWriter.Write(r.body.Bytes()); err != nil {
+		log.Printf("Cannot write response due to error: %s", err)
+	}
+}
+
+// idempotent middleware makes the handler safe to retry. The key is taken from
+// the Idempotency-Key header or the requestId param. A retry with the same key
+// returns the stored response, a different request with the same key is rejected.
+// Keys are scoped by the API key, so it should go after the authorize middleware.
+// The handler runs its operation with reservedKey, so the operation is committed along with the stored response.
+func idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Request.Header.Get("Idempotency-Key")
+		if len(key) == 0 {
+			key = c.Query(idempotencyKeyParam)
+		}
+
+		if len(key) == 0 {
+			c.Next()
+			return
+		}
+
+		apiKey := authorizedKey(c)
+		if apiKey == nil {
+			abortWithError(c, &models.Error{Code: models.CodeUnauthorized, Message: "API key is required"})
+			return
+		}
+
+		requestHash, err := hashRequest(c)
+		if err != nil {
+			abortWithError(c, bindingError(err))
+			return
+		}
+
+		idempotencyKey := models.IdempotencyKey{APIKeyID: apiKey.ID, Key: key, RequestHash: requestHash}
+		reserved, err := idempotencyKey.Reserve()
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		if !reserved {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(idempotencyKey.StatusCode, gin.MIMEJSON+"; charset=utf-8", idempotencyKey.Response)
+			c.Abort()
+			return
+		}
+
+		c.Set(idempotencyKeyContextKey, &idempotencyKey)
+		recorder := &responseRecorder{ResponseWriter: c.Writer, body: new(bytes.Buffer)}
+		c.Writer = recorder
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				c.Writer = recorder.ResponseWriter
+				releaseIdempotencyKey(&idempotencyKey)
+				panic(recovered)
+			}
+		}()
+
+		c.Next()
+		c.Writer = recorder.ResponseWriter
+
+		// server errors are not stored and the operation is rolled back, so the client is able to retry the request
+		if recorder.Status() >= http.StatusInternalServerError {
+			releaseIdempotencyKey(&idempotencyKey)
+			recorder.flush()
+			return
+		}
+
+		// the operation is committed along with the response, so the failed save applies nothing
+		idempotencyKey.StatusCode = recorder.Status()
+		idempotencyKey.Response = recorder.body.Bytes()
+		if err := idempotencyKey.Save(); err != nil {
+			respondWithError(c, err)
+			return
+		}
+
+		recorder.flush()
+	}
+}
+
+// reservedKey function returns the idempotency key reserved for the request, nil when the request has no key.
+// The operation of the handler should run with it.
+func reservedKey(c *gin.Context) *models.IdempotencyKey {
+	if idempotencyKey, ok := c.Get(idempotencyKeyContextKey); ok {
+		return idempotencyKey.(*models.IdempotencyKey)
+	}
+
+	return nil
+}
+
+func releaseIdempotencyKey(idempotencyKey *models.IdempotencyKey) {
+	if err := idempotencyKey.Release(); err != nil {
+		log.Printf("Cannot release idempotency key %q due to error: %s", idempotencyKey.Key, err)
+	}
+}
+
+// hashRequest function returns the hash of the method, path, params (without the key itself) and body
+func hashRequest(c *gin.Context) (string, error) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", err
+	}
+	c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	params := c.Request.URL.Query()
+	params.Del(idempotencyKeyParam)
+
+	hash := sha256.New()
+	hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "?" + params.Encode() + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
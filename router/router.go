@@ -1,19 +1,74 @@
 package router
 
-import "github.com/gin-gonic/gin"
+import (
+	"bidder/models"
+
+	"github.com/gin-gonic/gin"
+)
 
 // New creates, configures and returns ready to work router
 func New() *gin.Engine {
 	r := gin.Default()
 
-	r.GET("/take", takeHandler)
-	r.GET("/fund", fundHandler)
-	r.GET("/announceTournament", announceTournamentHandler)
-	r.GET("/joinTournament", joinTournamentHandler)
-	r.GET("/balance", balanceHandler)
-	r.GET("/reset", resetHandler)
+	// legacy routes are kept working, but every state-changing one has a successor in v2
+	v1 := r.Group("/", deprecated())
+	{
+		v1.GET("/take", authorize(cashiers...), idempotent(), takeHandler)
+		v1.GET("/fund", authorize(cashiers...), idempotent(), fundHandler)
+		v1.GET("/announceTournament", authorize(operators...), announceTournamentHandler)
+		v1.GET("/joinTournament", authorize(operators...), idempotent(), joinTournamentHandler)
+		v1.GET("/balance", authorize(readers...), balanceHandler)
+		v1.GET("/reset", resetGuard(), resetHandler)
+		v1.GET("/players/:id/transactions", authorize(readers...), transactionsHandler)
+
+		v1.POST("/resultTournament", authorize(operators...), signedByPartner(), idempotent(), resultTournamentHandler)
+		v1.POST("/tournaments/:id/close", authorize(operators...), tournamentStatusHandler(models.TournamentRegistrationClosed))
+		v1.POST("/tournaments/:id/open", authorize(operators...), tournamentStatusHandler(models.TournamentAnnounced))
+		v1.POST("/tournaments/:id/start", authorize(operators...), tournamentStatusHandler(models.TournamentRunning))
+		v1.POST("/tournaments/:id/cancel", authorize(operators...), cancelTournamentHandler)
+		v1.POST("/tournaments/:id/leave", authorize(operators...), leaveTournamentHandler)
+	}
+
+	v2 := r.Group("/v2")
+	{
+		v2.POST("/players", authorize(cashiers...), registerPlayerHandler)
+		v2.POST("/players/batch", authorize(cashiers...), idempotent(), playersBatchHandler)
+		v2.GET("/players/:id", authorize(readers...), playerBalanceHandler)
+		v2.PATCH("/players/:id", authorize(cashiers...), updatePlayerHandler)
+		v2.DELETE("/players/:id", authorize(cashiers...), closePlayerHandler)
+		v2.GET("/players/:id/transactions", authorize(readers...), transactionsHandler)
+		v2.POST("/players/:id/fund", authorize(cashiers...), idempotent(), fundPlayerHandler)
+		v2.POST("/players/:id/take", authorize(cashiers...), idempotent(), takePlayerHandler)
+		v2.POST("/players/:id/holds", authorize(cashiers...), idempotent(), placeHoldHandler)
+		v2.POST("/transfers", authorize(cashiers...), idempotent(), transferHandler)
+		v2.GET("/holds/:id", authorize(readers...), holdHandler)
+		v2.POST("/holds/:id/capture", authorize(cashiers...), idempotent(), captureHoldHandler)
+		v2.POST("/holds/:id/release", authorize(cashiers...), idempotent(), releaseHoldHandler)
 
-	r.POST("/resultTournament", resultTournamentHandler)
+		v2.GET("/tournaments", authorize(readers...), tournamentsHandler)
+		v2.POST("/tournaments", authorize(operators...), idempotent(), createTournamentHandler)
+		v2.GET("/tournaments/:id", authorize(readers...), tournamentHandler)
+		v2.GET("/tournaments/:id/attendees", authorize(readers...), tournamentAttendeesHandler)
+		v2.POST("/tournaments/:id/attendees", authorize(operators...), idempotent(), addAttendeeHandler)
+		v2.DELETE("/tournaments/:id/attendees/:playerId", authorize(operators...), removeAttendeeHandler)
+		v2.GET("/tournaments/:id/results", authorize(readers...), tournamentResultsHandler)
+		v2.POST("/tournaments/:id/results", authorize(operators...), signedByPartner(), idempotent(), tournamentResultHandler)
+		v2.POST("/tournaments/:id/close", authorize(operators...), tournamentStatusHandler(models.TournamentRegistrationClosed))
+		v2.POST("/tournaments/:id/open", authorize(operators...), tournamentStatusHandler(models.TournamentAnnounced))
+		v2.POST("/tournaments/:id/start", authorize(operators...), tournamentStatusHandler(models.TournamentRunning))
+		v2.POST("/tournaments/:id/cancel", authorize(operators...), cancelTournamentHandler)
+
+		v2.POST("/reset", resetGuard(), resetHandler)
+	}
 
 	return r
 }
+
+// deprecated middleware marks the response of the legacy route, so clients are able to find the successor
+func deprecated() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", `</v2>; rel="successor-version"`)
+		c.Next()
+	}
+}
@@ -0,0 +1,108 @@
+package router
+
+import (
+	"bidder/models"
+	"bidder/util"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	partnerHeader   = "X-Partner-Id"
+	timestampHeader = "X-Timestamp"
+	signatureHeader = "X-Signature"
+
+	signatureContextKey = "signature"
+)
+
+// signedByPartner middleware lets the request through only if it is signed by one of the partners.
+// The signature is the hex HMAC-SHA256 of the timestamp, the path and the body joined with new lines,
+// made with the partner's shared secret. Stale signatures are rejected here and already received ones
+// are rejected by the handler, after the retry with the same idempotency key got its stored response.
+// The check is skipped while no partner secrets are configured.
+func signedByPartner() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secrets := util.ResultSigningSecrets()
+		if len(secrets) == 0 {
+			c.Next()
+			return
+		}
+
+		partnerID := c.Request.Header.Get(partnerHeader)
+		secret, ok := secrets[partnerID]
+		if !ok {
+			abortWithError(c, signatureError("Request should be signed by the known partner"))
+			return
+		}
+
+		timestamp := c.Request.Header.Get(timestampHeader)
+		if err := checkTimestamp(timestamp, util.SignatureWindow()); err != nil {
+			abortWithError(c, err)
+			return
+		}
+
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			abortWithError(c, bindingError(err))
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+		signature := c.Request.Header.Get(signatureHeader)
+		expected := signRequest(secret, timestamp, c.Request.URL.Path, body)
+		if !hmac.Equal([]byte(signature), []byte(expected)) {
+			log.Printf("AUDIT: rejected signed request from partner %q: invalid signature", partnerID)
+			abortWithError(c, signatureError("Request signature is invalid"))
+			return
+		}
+
+		c.Set(signatureContextKey, &models.SignedRequest{PartnerID: partnerID, Signature: expected})
+		c.Next()
+	}
+}
+
+// partnerSignature function returns the verified signature of the request, nil when signatures are not checked.
+// The handler registers it along with the operation, so the request is applied only once.
+func partnerSignature(c *gin.Context) *models.SignedRequest {
+	if signature, ok := c.Get(signatureContextKey); ok {
+		return signature.(*models.SignedRequest)
+	}
+
+	return nil
+}
+
+// checkTimestamp function makes sure the request was signed within the window
+func checkTimestamp(timestamp string, window time.Duration) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return signatureError("Request timestamp should be unix time in seconds")
+	}
+
+	age := time.Since(time.Unix(seconds, 0))
+	if age > window || age < -window {
+		return signatureError("Request timestamp is outside of the allowed window")
+	}
+
+	return nil
+}
+
+// signRequest function returns the hex HMAC-SHA256 of the signed request parts
+func signRequest(secret, timestamp, path string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + path + "\n"))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func signatureError(message string) error {
+	return &models.Error{Code: models.CodeInvalidSignature, Message: message}
+}
@@ -3,6 +3,9 @@ package util
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -23,3 +26,95 @@ func prepareDotEnv() {
 		}
 	}
 }
+
+// ResetAllowed function tells whether the DataBase reset endpoint is enabled.
+// It is controlled by ALLOW_RESET setting and is disabled by default in release mode.
+func ResetAllowed() bool {
+	if allowed, err := strconv.ParseBool(os.Getenv("ALLOW_RESET")); err == nil {
+		return allowed
+	}
+
+	return os.Getenv("GIN_MODE") != "release"
+}
+
+// AdminToken function returns the credential required by the admin endpoints.
+// Admin endpoints are disabled while it is empty.
+func AdminToken() string {
+	return os.Getenv("ADMIN_TOKEN")
+}
+
+// ResultSigningSecrets function returns the shared secrets of the partners allowed to submit
+// tournament results, taken from RESULT_SIGNING_SECRETS setting in "partner:secret,partner:secret" form.
+// Result signatures are not checked while it is empty.
+func ResultSigningSecrets() map[string]string {
+	secrets := make(map[string]string)
+
+	for _, pair := range strings.Split(os.Getenv("RESULT_SIGNING_SECRETS"), ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(parts) == 2 && len(parts[0]) != 0 && len(parts[1]) != 0 {
+			secrets[parts[0]] = parts[1]
+		}
+	}
+
+	return secrets
+}
+
+// SignatureWindow function returns how old the signed request could be,
+// taken from RESULT_SIGNATURE_WINDOW setting in seconds. It is 5 minutes by default.
+func SignatureWindow() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("RESULT_SIGNATURE_WINDOW")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	return 5 * time.Minute
+}
+
+// IdempotencyKeyTTL function returns how long the response is replayed for the idempotency key,
+// taken from IDEMPOTENCY_KEY_TTL setting in seconds. It is 24 hours by default, older keys are forgotten.
+func IdempotencyKeyTTL() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_KEY_TTL")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	return 24 * time.Hour
+}
+
+// IdempotencyWait function returns how long the retry waits for the request in progress with the same idempotency key,
+// taken from IDEMPOTENCY_WAIT setting in seconds. It is 10 seconds by default.
+func IdempotencyWait() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_WAIT")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	return 10 * time.Second
+}
+
+// BonusFirst function tells whether the tournament deposit is paid with the bonus before the withdrawable points.
+// It is controlled by BONUS_FIRST setting and is enabled by default.
+func BonusFirst() bool {
+	if bonusFirst, err := strconv.ParseBool(os.Getenv("BONUS_FIRST")); err == nil {
+		return bonusFirst
+	}
+
+	return true
+}
+
+// WageringMultiplier function returns how many times the prize won with the bonus should be wagered
+// before it could be withdrawn, taken from WAGERING_MULTIPLIER setting. It is 1 by default.
+func WageringMultiplier() int {
+	if multiplier, err := strconv.Atoi(os.Getenv("WAGERING_MULTIPLIER")); err == nil && multiplier >= 0 {
+		return multiplier
+	}
+
+	return 1
+}
+
+// SchedulerInterval function returns how often the due tournaments are processed,
+// taken from SCHEDULER_INTERVAL setting in seconds. It is 30 seconds by default, zero disables the scheduler.
+func SchedulerInterval() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("SCHEDULER_INTERVAL")); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	return 30 * time.Second
+}
@@ -50,5 +50,7 @@ func migrateDatabase() {
 		log.Fatalf("Cannot migrate DB due to error: %s", err)
 	}
 
-	m.Steps(3)
+	if err = m.Up(); err != nil && err != migrate.ErrNoChange {
+		log.Fatalf("Cannot migrate DB due to error: %s", err)
+	}
 }